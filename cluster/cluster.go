@@ -0,0 +1,534 @@
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/NeowayLabs/cloud-machine/errs"
+	"github.com/NeowayLabs/cloud-machine/instance"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/cloud-machine/snapshot"
+	"github.com/NeowayLabs/cloud-machine/tags"
+	"github.com/NeowayLabs/cloud-machine/volume"
+	"gopkg.in/amz.v3/aws"
+	"gopkg.in/amz.v3/ec2"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// Clusters ...
+	Clusters struct {
+		Default   Default
+		Retention snapshot.Retention
+		Clusters  []struct {
+			Name           string
+			Machine        string
+			Nodes          int
+			Retention      snapshot.Retention
+			Placements     []instance.Placement
+			NodePlacements map[int]string
+			Overrides      map[int]Override
+			DependsOn      []string
+			Naming         string
+			VolumeNaming   string
+			Padding        int
+			Environment    string
+			Role           string
+			MaxUnavailable int
+			HealthCheck    instance.HealthCheck
+		}
+	}
+
+	// Cluster ...
+	Cluster struct {
+		Name           string
+		Machine        machine.Machine
+		Nodes          int
+		Retention      snapshot.Retention
+		Placements     []instance.Placement // nodes are distributed round-robin between placements
+		NodePlacements map[int]string       // available zone of the placement of some nodes
+		Overrides      map[int]Override     // changes of the machine of some nodes
+		DependsOn      []string             // names of the clusters that must be created before
+		Naming         Naming               // Name tags of the instances and volumes
+		Environment    string
+		Role           string
+		MaxUnavailable int                  // nodes updated at the same time
+		HealthCheck    instance.HealthCheck // checked after a node is updated
+	}
+
+	// Override changes the machine of one node, empty values are not changed
+	Override struct {
+		Type          string
+		PrivateIP     string
+		SubnetID      string
+		AvailableZone string
+		Tags          []ec2.Tag
+		Volumes       map[string]VolumeOverride // by volume name of the machine file
+	}
+
+	// VolumeOverride changes one volume of a node
+	VolumeOverride struct {
+		ID         string
+		SnapshotID string
+	}
+
+	// Default ...
+	Default struct {
+		ImageID              string
+		Region               string
+		KeyName              string
+		SecurityGroups       []string
+		SubnetID             string
+		AvailableZone        string
+		DefaultAvailableZone string // backward compatibility, use availablezone instead
+		Placements           []instance.Placement
+		Tags                 []ec2.Tag
+		Naming               string
+		VolumeNaming         string
+		Padding              int
+		Environment          string
+	}
+)
+
+// Load read a cluster file and all machine files used by it, the default
+// values of the cluster file are set on each machine
+func Load(clusterFile string) ([]Cluster, error) {
+	clusterContent, err := ioutil.ReadFile(clusterFile)
+	if err != nil {
+		return nil, &errs.ConfigError{Message: "Error open cluster file", Err: err}
+	}
+
+	var clusters Clusters
+	err = yaml.Unmarshal(clusterContent, &clusters)
+	if err != nil {
+		return nil, &errs.ConfigError{Message: "Error reading cluster file", Err: err}
+	}
+
+	if clusters.Default.AvailableZone == "" {
+		if clusters.Default.DefaultAvailableZone != "" {
+			clusters.Default.AvailableZone = clusters.Default.DefaultAvailableZone
+		}
+	}
+
+	// First verify if I can open all machine files
+	machines := make([]Cluster, len(clusters.Clusters))
+	for key := range clusters.Clusters {
+		clusterConfig := &clusters.Clusters[key]
+
+		machineContent, err := ioutil.ReadFile(clusterConfig.Machine)
+		if err != nil {
+			return nil, &errs.ConfigError{Message: "Error open machine file", Err: err}
+		}
+
+		var machineConfig machine.Machine
+		err = yaml.Unmarshal(machineContent, &machineConfig)
+		if err != nil {
+			return nil, &errs.ConfigError{Message: "Error reading machine file", Err: err}
+		}
+
+		// Verify if cloud-config file exists and, when it's a template, if it's valid
+		if machineConfig.Instance.CloudConfig != "" {
+			if machineConfig.Instance.CloudConfigTemplate {
+				_, err = instance.ParseCloudConfig(machineConfig.Instance.CloudConfig)
+			} else {
+				_, err = os.Stat(machineConfig.Instance.CloudConfig)
+				if err != nil {
+					err = &errs.ConfigError{Message: "Error reading cloud-config", Err: err}
+				}
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Set default values of cluster to machine
+		if machineConfig.Instance.ImageID == "" {
+			machineConfig.Instance.ImageID = clusters.Default.ImageID
+		}
+		if machineConfig.Instance.Region == "" {
+			machineConfig.Instance.Region = clusters.Default.Region
+		}
+		if machineConfig.Instance.KeyName == "" {
+			machineConfig.Instance.KeyName = clusters.Default.KeyName
+		}
+		if len(machineConfig.Instance.SecurityGroups) == 0 {
+			machineConfig.Instance.SecurityGroups = clusters.Default.SecurityGroups
+		}
+		if machineConfig.Instance.SubnetID == "" {
+			machineConfig.Instance.SubnetID = clusters.Default.SubnetID
+		}
+
+		if machineConfig.Instance.AvailableZone == "" {
+			if machineConfig.Instance.DefaultAvailableZone != "" {
+				machineConfig.Instance.AvailableZone = machineConfig.Instance.DefaultAvailableZone
+			} else {
+				machineConfig.Instance.AvailableZone = clusters.Default.AvailableZone
+			}
+		}
+
+		// placements of the cluster override the machine, default placements
+		// are used only when the machine doesn't have an available zone
+		placements := clusterConfig.Placements
+		if len(placements) == 0 && machineConfig.Instance.AvailableZone == "" {
+			placements = clusters.Default.Placements
+		}
+
+		for node, availableZone := range clusterConfig.NodePlacements {
+			if findPlacement(placements, availableZone) < 0 {
+				return nil, &errs.ConfigError{Message: fmt.Sprintf("Node %d of cluster <%s> uses the available zone <%s> that isn't in the placements", node, clusterConfig.Machine, availableZone)}
+			}
+		}
+
+		for node, override := range clusterConfig.Overrides {
+			if node < 1 || node > clusterConfig.Nodes {
+				return nil, &errs.ConfigError{Message: fmt.Sprintf("Cluster <%s> has %d node(s), cannot override node %d", clusterConfig.Machine, clusterConfig.Nodes, node)}
+			}
+
+			for volumeName := range override.Volumes {
+				if findVolume(machineConfig.Volumes, volumeName) < 0 {
+					return nil, &errs.ConfigError{Message: fmt.Sprintf("Machine <%s> doesn't have the volume <%s> overridden by node %d", clusterConfig.Machine, volumeName, node)}
+				}
+			}
+		}
+
+		if machineConfig.Instance.AvailableZone == "" && len(placements) > 0 {
+			machineConfig.Instance.AvailableZone = placements[0].AvailableZone
+			machineConfig.Instance.SubnetID = placements[0].SubnetID
+		}
+
+		machineConfig.Instance.Tags = tags.Merge(machineConfig.Instance.Tags, clusters.Default.Tags)
+		for k := range machineConfig.Volumes {
+			machineConfig.Volumes[k].Tags = tags.Merge(machineConfig.Volumes[k].Tags, clusters.Default.Tags)
+		}
+
+		name := clusterConfig.Name
+		if name == "" {
+			name = machineConfig.Instance.Name
+		}
+
+		retention := clusterConfig.Retention
+		if retention.Empty() {
+			retention = clusters.Retention
+		}
+
+		instanceNaming := clusterConfig.Naming
+		volumeNaming := clusterConfig.VolumeNaming
+		if instanceNaming == "" && volumeNaming == "" {
+			instanceNaming = clusters.Default.Naming
+			volumeNaming = clusters.Default.VolumeNaming
+		}
+
+		naming, err := parseNaming(instanceNaming, volumeNaming)
+		if err != nil {
+			return nil, err
+		}
+
+		naming.Padding = clusterConfig.Padding
+		if naming.Padding <= 0 {
+			naming.Padding = clusters.Default.Padding
+		}
+		if naming.Padding <= 0 {
+			naming.Padding = DefaultPadding
+		}
+
+		environment := clusterConfig.Environment
+		if environment == "" {
+			environment = clusters.Default.Environment
+		}
+
+		role := clusterConfig.Role
+		if role == "" {
+			role = machineConfig.Instance.Name
+		}
+
+		maxUnavailable := clusterConfig.MaxUnavailable
+		if maxUnavailable <= 0 {
+			maxUnavailable = 1
+		}
+
+		machines[key] = Cluster{
+			Name:           name,
+			Machine:        machineConfig,
+			Nodes:          clusterConfig.Nodes,
+			Retention:      retention,
+			Placements:     placements,
+			NodePlacements: clusterConfig.NodePlacements,
+			Overrides:      clusterConfig.Overrides,
+			DependsOn:      clusterConfig.DependsOn,
+			Naming:         naming,
+			Environment:    environment,
+			Role:           role,
+			MaxUnavailable: maxUnavailable,
+			HealthCheck:    clusterConfig.HealthCheck,
+		}
+
+		// Verify if every node has a different name
+		nodeNames := make(map[string]bool)
+		for i := 1; i <= clusterConfig.Nodes; i++ {
+			node, err := machines[key].Node(i)
+			if err != nil {
+				return nil, err
+			}
+
+			if nodeNames[node.Instance.Name] {
+				return nil, &errs.ConfigError{Message: fmt.Sprintf("The naming of cluster <%s> gives the name <%s> to more than one node", name, node.Instance.Name)}
+			}
+			nodeNames[node.Instance.Name] = true
+		}
+	}
+
+	return sortByDependencies(machines)
+}
+
+// sortByDependencies returns the clusters ordered so that each cluster comes
+// after the clusters it depends on, otherwise the order of the cluster file
+// is kept
+func sortByDependencies(machines []Cluster) ([]Cluster, error) {
+	names := make(map[string]bool)
+	for _, clusterConfig := range machines {
+		if names[clusterConfig.Name] {
+			return nil, &errs.ConfigError{Message: fmt.Sprintf("There are two clusters named <%s>", clusterConfig.Name)}
+		}
+		names[clusterConfig.Name] = true
+	}
+
+	for _, clusterConfig := range machines {
+		for _, dependency := range clusterConfig.DependsOn {
+			if !names[dependency] {
+				return nil, &errs.ConfigError{Message: fmt.Sprintf("Cluster <%s> depends on <%s> that doesn't exist", clusterConfig.Name, dependency)}
+			}
+		}
+	}
+
+	sorted := make([]Cluster, 0, len(machines))
+	added := make(map[string]bool)
+	for len(sorted) < len(machines) {
+		progress := false
+		for _, clusterConfig := range machines {
+			if added[clusterConfig.Name] {
+				continue
+			}
+
+			ready := true
+			for _, dependency := range clusterConfig.DependsOn {
+				if !added[dependency] {
+					ready = false
+				}
+			}
+
+			if ready {
+				sorted = append(sorted, clusterConfig)
+				added[clusterConfig.Name] = true
+				progress = true
+				break
+			}
+		}
+
+		if !progress {
+			return nil, &errs.ConfigError{Message: "There is a cycle in the dependencies of the clusters"}
+		}
+	}
+
+	return sorted, nil
+}
+
+// Node returns the machine of node number index, the node number starts from 1.
+// The instance and volumes are tagged with the cluster name and node number,
+// these tags are used to find them again, and named by the cluster naming.
+func (cluster Cluster) Node(index int) (machine.Machine, error) {
+	machineConfig := cluster.Machine
+	machineConfig.Volumes = make([]volume.Volume, len(cluster.Machine.Volumes))
+
+	node := strconv.Itoa(index)
+
+	if len(cluster.Placements) > 0 {
+		placement := (index - 1) % len(cluster.Placements)
+		if availableZone, ok := cluster.NodePlacements[index]; ok {
+			placement = findPlacement(cluster.Placements, availableZone)
+		}
+
+		machineConfig.Instance.AvailableZone = cluster.Placements[placement].AvailableZone
+		machineConfig.Instance.SubnetID = cluster.Placements[placement].SubnetID
+
+		// when aws doesn't have capacity the other placements are tried
+		if len(machineConfig.Instance.FallbackPlacements) == 0 {
+			for i := 1; i < len(cluster.Placements); i++ {
+				fallback := cluster.Placements[(placement+i)%len(cluster.Placements)]
+				machineConfig.Instance.FallbackPlacements = append(machineConfig.Instance.FallbackPlacements, fallback)
+			}
+		}
+	}
+
+	machineConfig.Instance.Tags = tags.Set(machineConfig.Instance.Tags, tags.Cluster, cluster.Name)
+	machineConfig.Instance.Tags = tags.Set(machineConfig.Instance.Tags, tags.Node, node)
+
+	// tag volumes with the node, the volume name of the machine file is kept in tags
+	for key := range cluster.Machine.Volumes {
+		volumeConfig := cluster.Machine.Volumes[key]
+		volumeConfig.Tags = tags.Set(volumeConfig.Tags, tags.Cluster, cluster.Name)
+		volumeConfig.Tags = tags.Set(volumeConfig.Tags, tags.Node, node)
+		volumeConfig.Tags = tags.Set(volumeConfig.Tags, tags.Volume, volumeConfig.Name)
+		machineConfig.Volumes[key] = volumeConfig
+	}
+
+	if override, ok := cluster.Overrides[index]; ok {
+		override.apply(&machineConfig)
+	}
+
+	// names are rendered after the override, since it can change the available zone
+	data := NamingData{
+		Name:          cluster.Machine.Instance.Name,
+		Cluster:       cluster.Name,
+		Environment:   cluster.Environment,
+		Role:          cluster.Role,
+		Index:         index,
+		PaddedIndex:   padIndex(index, cluster.Naming.Padding),
+		AvailableZone: machineConfig.Instance.AvailableZone,
+	}
+
+	name, err := render(cluster.Naming.Instance, data)
+	if err != nil {
+		return machineConfig, err
+	}
+	machineConfig.Instance.Name = name
+
+	data.NodeName = name
+	for key := range machineConfig.Volumes {
+		data.Volume = machineConfig.Volumes[key].Name
+		name, err := render(cluster.Naming.Volume, data)
+		if err != nil {
+			return machineConfig, err
+		}
+		machineConfig.Volumes[key].Name = name
+	}
+
+	return machineConfig, nil
+}
+
+// Machines returns the machines of every node of the clusters or, when name
+// is informed, only of this cluster and, when node is greater than 0, only of
+// this node number
+func Machines(clusters []Cluster, name string, node int) ([]machine.Machine, error) {
+	machines := make([]machine.Machine, 0)
+	found := false
+	for _, clusterConfig := range clusters {
+		if name != "" && clusterConfig.Name != name {
+			continue
+		}
+		found = true
+
+		for i := 1; i <= clusterConfig.Nodes; i++ {
+			if node > 0 && i != node {
+				continue
+			}
+
+			machineConfig, err := clusterConfig.Node(i)
+			if err != nil {
+				return nil, err
+			}
+
+			machines = append(machines, machineConfig)
+		}
+	}
+
+	if !found {
+		return nil, &errs.ConfigError{Message: fmt.Sprintf("There isn't a cluster named <%s>", name)}
+	}
+
+	return machines, nil
+}
+
+// Instances returns the instances of the cluster that were not terminated, by
+// node number, including the nodes above the number of nodes of the cluster
+func (cluster Cluster) Instances(auth aws.Auth) (map[int]instance.Instance, error) {
+	ec2Ref := machine.EC2(cluster.Machine.Instance.Region, auth)
+
+	instances, err := instance.Find(ec2Ref, []ec2.Tag{{Key: tags.Cluster, Value: cluster.Name}})
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]instance.Instance)
+	for _, instanceInfo := range instances {
+		index, err := strconv.Atoi(tags.Get(instanceInfo.Tags, tags.Node))
+		if err != nil {
+			// it isn't a node created by cluster-up
+			continue
+		}
+
+		if other, ok := nodes[index]; ok {
+			return nil, &errs.ConfigError{Message: fmt.Sprintf("Node %d of cluster <%s> has two instances <%s> and <%s>", index, cluster.Name, other.ID, instanceInfo.ID)}
+		}
+
+		nodes[index] = instanceInfo
+	}
+
+	return nodes, nil
+}
+
+func findPlacement(placements []instance.Placement, availableZone string) int {
+	for key, placement := range placements {
+		if placement.AvailableZone == availableZone {
+			return key
+		}
+	}
+
+	return -1
+}
+
+func findVolume(volumes []volume.Volume, name string) int {
+	for key, volumeConfig := range volumes {
+		if volumeConfig.Name == name {
+			return key
+		}
+	}
+
+	return -1
+}
+
+// apply the override to the machine of a node, a node with a fixed subnet,
+// available zone or private IP doesn't use other placements
+func (override Override) apply(machineConfig *machine.Machine) {
+	if override.Type != "" {
+		machineConfig.Instance.Type = override.Type
+	}
+
+	if override.AvailableZone != "" {
+		machineConfig.Instance.AvailableZone = override.AvailableZone
+	}
+
+	if override.SubnetID != "" {
+		machineConfig.Instance.SubnetID = override.SubnetID
+	}
+
+	if override.PrivateIP != "" {
+		machineConfig.Instance.PrivateIP = override.PrivateIP
+	}
+
+	if override.AvailableZone != "" || override.SubnetID != "" || override.PrivateIP != "" {
+		machineConfig.Instance.FallbackPlacements = nil
+	}
+
+	for _, tag := range override.Tags {
+		machineConfig.Instance.Tags = tags.Set(machineConfig.Instance.Tags, tag.Key, tag.Value)
+	}
+
+	for volumeName, volumeOverride := range override.Volumes {
+		for key := range machineConfig.Volumes {
+			if tags.Get(machineConfig.Volumes[key].Tags, tags.Volume) != volumeName {
+				continue
+			}
+
+			if volumeOverride.ID != "" {
+				machineConfig.Volumes[key].ID = volumeOverride.ID
+			}
+
+			if volumeOverride.SnapshotID != "" {
+				machineConfig.Volumes[key].SnapshotID = volumeOverride.SnapshotID
+			}
+		}
+	}
+}
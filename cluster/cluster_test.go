@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortByDependencies(t *testing.T) {
+	cluster := func(name string, dependsOn ...string) Cluster {
+		return Cluster{Name: name, DependsOn: dependsOn}
+	}
+
+	tests := []struct {
+		name     string
+		clusters []Cluster
+		expected []string
+		fails    bool
+	}{
+		{"no dependencies", []Cluster{cluster("a"), cluster("b"), cluster("c")}, []string{"a", "b", "c"}, false},
+		{"dependency after", []Cluster{cluster("app", "db"), cluster("db")}, []string{"db", "app"}, false},
+		{"chain", []Cluster{cluster("web", "app"), cluster("app", "db"), cluster("db")}, []string{"db", "app", "web"}, false},
+		{"keeps file order", []Cluster{cluster("app", "db"), cluster("cache"), cluster("db")}, []string{"cache", "db", "app"}, false},
+		{"many dependencies", []Cluster{cluster("app", "db", "cache"), cluster("db"), cluster("cache")}, []string{"db", "cache", "app"}, false},
+		{"missing dependency", []Cluster{cluster("app", "db")}, nil, true},
+		{"duplicated name", []Cluster{cluster("db"), cluster("db")}, nil, true},
+		{"cycle", []Cluster{cluster("a", "b"), cluster("b", "a")}, nil, true},
+		{"self dependency", []Cluster{cluster("a", "a")}, nil, true},
+	}
+
+	for _, test := range tests {
+		sorted, err := sortByDependencies(test.clusters)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: should fail", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+
+		names := make([]string, len(sorted))
+		for key, clusterConfig := range sorted {
+			names[key] = clusterConfig.Name
+		}
+
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: order is %v, expected %v", test.name, names, test.expected)
+		}
+	}
+}
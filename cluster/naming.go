@@ -0,0 +1,93 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/NeowayLabs/cloud-machine/errs"
+)
+
+const (
+	// DefaultNaming keeps the name of the machine file with the node number
+	DefaultNaming = "{{.Name}}-{{.Index}}"
+	// DefaultVolumeNaming keeps the name of the volume with the node number
+	DefaultVolumeNaming = "{{.Volume}}-{{.Index}}"
+	// DefaultCustomVolumeNaming is used when only the instance naming is
+	// informed, so volumes follow the name of the node
+	DefaultCustomVolumeNaming = "{{.NodeName}}-{{.Volume}}"
+	// DefaultPadding is the number of digits of PaddedIndex
+	DefaultPadding = 2
+)
+
+type (
+	// Naming renders the Name tags of the instances and volumes of a cluster
+	Naming struct {
+		Instance *template.Template
+		Volume   *template.Template
+		Padding  int // digits of PaddedIndex
+	}
+
+	// NamingData is the values available to the naming templates
+	NamingData struct {
+		Name          string // instance name of the machine file
+		Volume        string // volume name of the machine file, empty for instances
+		NodeName      string // name of the instance, empty for instances
+		Cluster       string
+		Environment   string
+		Role          string
+		Index         int
+		PaddedIndex   string // node number with leading zeros, at least Padding digits
+		AvailableZone string
+	}
+)
+
+// parseNaming parses the naming templates of a cluster, empty templates use
+// the default naming
+func parseNaming(instanceNaming, volumeNaming string) (Naming, error) {
+	if volumeNaming == "" {
+		volumeNaming = DefaultVolumeNaming
+		if instanceNaming != "" {
+			volumeNaming = DefaultCustomVolumeNaming
+		}
+	}
+
+	if instanceNaming == "" {
+		instanceNaming = DefaultNaming
+	}
+
+	var naming Naming
+	var err error
+
+	naming.Instance, err = template.New("naming").Option("missingkey=error").Parse(instanceNaming)
+	if err != nil {
+		return naming, &errs.ConfigError{Message: "Error parsing naming", Err: err}
+	}
+
+	naming.Volume, err = template.New("volumenaming").Option("missingkey=error").Parse(volumeNaming)
+	if err != nil {
+		return naming, &errs.ConfigError{Message: "Error parsing volumenaming", Err: err}
+	}
+
+	return naming, nil
+}
+
+// padIndex returns the node number with leading zeros, the width doesn't
+// depend on the number of nodes, so scaling the cluster doesn't rename them
+func padIndex(index, width int) string {
+	return fmt.Sprintf("%0*d", width, index)
+}
+
+func render(tmpl *template.Template, data NamingData) (string, error) {
+	var name bytes.Buffer
+	err := tmpl.Execute(&name, data)
+	if err != nil {
+		return "", &errs.ConfigError{Message: fmt.Sprintf("Error rendering %s of node %d", tmpl.Name(), data.Index), Err: err}
+	}
+
+	if name.Len() == 0 {
+		return "", &errs.ConfigError{Message: fmt.Sprintf("The %s of node %d is empty", tmpl.Name(), data.Index)}
+	}
+
+	return name.String(), nil
+}
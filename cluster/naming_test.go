@@ -0,0 +1,102 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/NeowayLabs/cloud-machine/instance"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/cloud-machine/volume"
+)
+
+func TestPadIndex(t *testing.T) {
+	tests := []struct {
+		index    int
+		width    int
+		expected string
+	}{
+		{1, 0, "1"},
+		{1, 1, "1"},
+		{1, 2, "01"},
+		{9, 2, "09"},
+		{10, 2, "10"},
+		{100, 2, "100"},
+		{7, 4, "0007"},
+	}
+
+	for _, test := range tests {
+		padded := padIndex(test.index, test.width)
+		if padded != test.expected {
+			t.Errorf("padIndex(%d, %d) is <%s>, expected <%s>", test.index, test.width, padded, test.expected)
+		}
+	}
+}
+
+func TestNaming(t *testing.T) {
+	tests := []struct {
+		name           string
+		naming         string
+		volumeNaming   string
+		padding        int
+		index          int
+		expectedName   string
+		expectedVolume string
+	}{
+		{"default", "", "", DefaultPadding, 3, "mongo-3", "data-3"},
+		{"custom instance", "{{.Cluster}}-{{.Role}}-{{.PaddedIndex}}", "", DefaultPadding, 3, "db-primary-03", "db-primary-03-data"},
+		{"custom volume", "", "{{.Cluster}}-{{.Volume}}-{{.Index}}", DefaultPadding, 3, "mongo-3", "db-data-3"},
+		{"padding", "{{.Name}}-{{.PaddedIndex}}", "{{.NodeName}}-{{.Volume}}", 3, 12, "mongo-012", "mongo-012-data"},
+		{"available zone", "{{.Name}}-{{.AvailableZone}}-{{.Index}}", "", DefaultPadding, 1, "mongo-us-east-1a-1", "mongo-us-east-1a-1-data"},
+	}
+
+	for _, test := range tests {
+		naming, err := parseNaming(test.naming, test.volumeNaming)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+		naming.Padding = test.padding
+
+		clusterConfig := Cluster{
+			Name:  "db",
+			Role:  "primary",
+			Nodes: test.index,
+			Machine: machine.Machine{
+				Instance: instance.Instance{Name: "mongo", AvailableZone: "us-east-1a"},
+				Volumes:  []volume.Volume{{Name: "data"}},
+			},
+			Naming: naming,
+		}
+
+		machineConfig, err := clusterConfig.Node(test.index)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+
+		if machineConfig.Instance.Name != test.expectedName {
+			t.Errorf("%s: instance name is <%s>, expected <%s>", test.name, machineConfig.Instance.Name, test.expectedName)
+		}
+
+		if machineConfig.Volumes[0].Name != test.expectedVolume {
+			t.Errorf("%s: volume name is <%s>, expected <%s>", test.name, machineConfig.Volumes[0].Name, test.expectedVolume)
+		}
+	}
+}
+
+func TestNamingErrors(t *testing.T) {
+	_, err := parseNaming("{{.Name", "")
+	if err == nil {
+		t.Errorf("an invalid naming should fail")
+	}
+
+	naming, err := parseNaming("{{.Unknown}}", "")
+	if err != nil {
+		t.Fatalf("%s", err.Error())
+	}
+
+	clusterConfig := Cluster{Name: "db", Nodes: 1, Naming: naming}
+	_, err = clusterConfig.Node(1)
+	if err == nil {
+		t.Errorf("a naming with an unknown field should fail")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/cluster"
+	"github.com/NeowayLabs/cloud-machine/ec2ext"
+	"github.com/NeowayLabs/cloud-machine/instance"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/cloud-machine/volume"
+	"github.com/NeowayLabs/logger"
+	"gopkg.in/amz.v3/aws"
+)
+
+// Valid values of the status of a node
+const (
+	statusOK      = "ok"
+	statusMissing = "missing" // the node doesn't have an instance
+	statusExtra   = "extra"   // the node is above the number of nodes of the cluster
+)
+
+type (
+	nodeStatus struct {
+		Cluster       string         `json:"cluster"`
+		Node          int            `json:"node"`
+		Status        string         `json:"status"`
+		Name          string         `json:"name"`
+		ID            string         `json:"id"`
+		State         string         `json:"state"`
+		Type          string         `json:"type"`
+		AvailableZone string         `json:"availablezone"`
+		PrivateIP     string         `json:"privateip"`
+		PublicIP      string         `json:"publicip"`
+		LaunchTime    string         `json:"launchtime"`
+		Volumes       []volumeStatus `json:"volumes"`
+	}
+
+	volumeStatus struct {
+		Name   string `json:"name"`
+		ID     string `json:"id"`
+		Device string `json:"device"`
+		Size   int    `json:"size"`
+		State  string `json:"state"`
+	}
+)
+
+var (
+	accessKey  = flag.String("access-key", "", "AWS Access Key")
+	secretKey  = flag.String("secret-key", "", "AWS Secret Key")
+	jsonOutput = flag.Bool("json", false, "Print the status as json")
+)
+
+func main() {
+	flag.Parse()
+
+	clusterFile := flag.Arg(0)
+	if clusterFile == "" {
+		logger.Fatal("You need to pass the cluster file, type: %s <cluster-file.yml>\n", os.Args[0])
+	}
+
+	clusters, err := cluster.Load(clusterFile)
+	if err != nil {
+		logger.Fatal("%s", err.Error())
+	}
+
+	var authInfo aws.Auth
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
+		}
+	}
+
+	machine.SetLogger(ioutil.Discard, "", 0)
+
+	nodes := make([]nodeStatus, 0)
+	for _, clusterConfig := range clusters {
+		clusterNodes, err := clusterStatus(clusterConfig, authInfo)
+		if err != nil {
+			logger.Fatal("Error loading nodes of cluster <%s>: %s", clusterConfig.Name, err.Error())
+		}
+
+		nodes = append(nodes, clusterNodes...)
+	}
+
+	if *jsonOutput {
+		content, err := json.MarshalIndent(nodes, "", "  ")
+		if err != nil {
+			logger.Fatal("Error writing json: %s", err.Error())
+		}
+
+		fmt.Println(string(content))
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "CLUSTER\tNODE\tSTATUS\tNAME\tID\tSTATE\tTYPE\tAVAILABLE ZONE\tPRIVATE IP\tPUBLIC IP\tLAUNCH TIME\tVOLUMES")
+	for _, node := range nodes {
+		volumes := make([]string, len(node.Volumes))
+		for key, volumeInfo := range node.Volumes {
+			volumes[key] = fmt.Sprintf("%s %s %dGB %s", volumeInfo.Name, volumeInfo.ID, volumeInfo.Size, volumeInfo.State)
+		}
+
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", node.Cluster, node.Node, node.Status, node.Name, node.ID, node.State, node.Type, node.AvailableZone, node.PrivateIP, node.PublicIP, node.LaunchTime, strings.Join(volumes, ", "))
+	}
+	table.Flush()
+}
+
+// clusterStatus returns the status of every node of the cluster, the nodes
+// are found by the Id of the machine file or by their tags, nodes without
+// instance are missing and instances above the number of nodes are extra
+func clusterStatus(clusterConfig cluster.Cluster, authInfo aws.Auth) ([]nodeStatus, error) {
+	ec2Ref := machine.EC2(clusterConfig.Machine.Instance.Region, authInfo)
+
+	nodes := make([]nodeStatus, 0)
+	for i := 1; i <= clusterConfig.Nodes; i++ {
+		machineConfig, err := clusterConfig.Node(i)
+		if err != nil {
+			return nil, err
+		}
+
+		err = machine.Lookup(&machineConfig, authInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		node := nodeStatus{Cluster: clusterConfig.Name, Node: i, Status: statusMissing, Name: machineConfig.Instance.Name}
+		if machineConfig.Instance.ID == "" {
+			// volumes of a missing instance could be kept
+			for _, volumeInfo := range machineConfig.Volumes {
+				if volumeInfo.ID != "" {
+					node.Volumes = append(node.Volumes, newVolumeStatus(volumeInfo))
+				}
+			}
+
+			nodes = append(nodes, node)
+			continue
+		}
+
+		node, err = newNodeStatus(ec2Ref, clusterConfig.Name, i, statusOK, machineConfig.Instance)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	existing, err := clusterConfig.Instances(authInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	extras := make([]int, 0)
+	for index := range existing {
+		if index < 1 || index > clusterConfig.Nodes {
+			extras = append(extras, index)
+		}
+	}
+	sort.Ints(extras)
+
+	for _, index := range extras {
+		node, err := newNodeStatus(ec2Ref, clusterConfig.Name, index, statusExtra, existing[index])
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func newNodeStatus(ec2Ref *ec2ext.EC2, clusterName string, index int, status string, instanceInfo instance.Instance) (nodeStatus, error) {
+	node := nodeStatus{
+		Cluster:       clusterName,
+		Node:          index,
+		Status:        status,
+		Name:          instanceInfo.Name,
+		ID:            instanceInfo.ID,
+		State:         instanceInfo.State.Name,
+		Type:          instanceInfo.Type,
+		AvailableZone: instanceInfo.AvailableZone,
+		PrivateIP:     instanceInfo.PrivateIPAddress,
+		PublicIP:      instanceInfo.IPAddress,
+	}
+
+	launchTime, err := instance.LaunchTime(ec2Ref, instanceInfo)
+	if err != nil {
+		return node, err
+	}
+	node.LaunchTime = launchTime.Format(time.RFC3339)
+
+	attached, err := volume.Attached(ec2Ref, instanceInfo.ID)
+	if err != nil {
+		return node, err
+	}
+
+	for _, volumeInfo := range attached {
+		node.Volumes = append(node.Volumes, newVolumeStatus(volumeInfo))
+	}
+
+	return node, nil
+}
+
+func newVolumeStatus(volumeInfo volume.Volume) volumeStatus {
+	status := volumeStatus{Name: volumeInfo.Name, ID: volumeInfo.ID, Size: volumeInfo.Size, State: volumeInfo.Status}
+	for _, attachment := range volumeInfo.Attachments {
+		status.Device = attachment.Device
+	}
+
+	return status
+}
@@ -1,53 +1,42 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/cluster"
+	"github.com/NeowayLabs/cloud-machine/errs"
+	"github.com/NeowayLabs/cloud-machine/instance"
 	"github.com/NeowayLabs/cloud-machine/machine"
-	"github.com/NeowayLabs/cloud-machine/volume"
+	"github.com/NeowayLabs/cloud-machine/retry"
+	"github.com/NeowayLabs/cloud-machine/snapshot"
 	"github.com/NeowayLabs/logger"
 	"gopkg.in/amz.v3/aws"
-	"gopkg.in/amz.v3/ec2"
-	"gopkg.in/yaml.v2"
 )
 
-type (
-	// Clusters ...
-	Clusters struct {
-		Default  Default
-		Clusters []struct {
-			Machine string
-			Nodes   int
-		}
-	}
-
-	// Cluster ...
-	Cluster struct {
-		Machine machine.Machine
-		Nodes   int
-	}
-
-	// Default ...
-	Default struct {
-		ImageID              string
-		Region               string
-		KeyName              string
-		SecurityGroups       []string
-		SubnetID             string
-		AvailableZone        string
-		DefaultAvailableZone string // backward compatibility, use availablezone instead
-		Tags                 []ec2.Tag
-	}
+const (
+	maxAttempts = 3
+	retryDelay  = 30 * time.Second
 )
 
 var (
-	accessKey = flag.String("access-key", "", "AWS Access Key")
-	secretKey = flag.String("secret-key", "", "AWS Secret Key")
+	accessKey     = flag.String("access-key", "", "AWS Access Key")
+	secretKey     = flag.String("secret-key", "", "AWS Secret Key")
+	restore       = flag.String("restore", "", "Snapshot manifest used to restore the volumes of the cluster")
+	yes           = flag.Bool("yes", false, "Destroy the nodes removed from the cluster file without asking for confirmation")
+	allowDowntime = flag.Bool("allow-downtime", false, "Stop the instances to change their type")
+	replace       = flag.Bool("replace", false, "Replace the instances whose image is different, one node at a time")
+	undoFallback  = flag.Bool("undo-fallback", false, "Change the type of the instances created with a fallback type too")
+	reboot        = flag.Bool("reboot", false, "Reboot the existing instances, maxunavailable nodes at a time")
 )
 
 func main() {
@@ -58,147 +47,460 @@ func main() {
 		logger.Fatal("You need to pass the cluster file, type: %s <cluster-file.yml>\n", os.Args[0])
 	}
 
-	clusterContent, err := ioutil.ReadFile(clusterFile)
+	machines, err := cluster.Load(clusterFile)
 	if err != nil {
-		logger.Fatal("Error open cluster file: %s", err.Error())
+		logger.Fatal("%s", err.Error())
 	}
 
-	var clusters Clusters
-	err = yaml.Unmarshal(clusterContent, &clusters)
-	if err != nil {
-		logger.Fatal("Error reading cluster file: %s", err.Error())
+	var manifest snapshot.Manifest
+	if *restore != "" {
+		manifest, err = snapshot.LoadManifest(*restore)
+		if err != nil {
+			logger.Fatal("Error reading snapshot manifest: %s", err.Error())
+		}
+
+		err = verifyManifest(manifest, machines)
+		if err != nil {
+			logger.Fatal("Error verifying snapshot manifest: %s", err.Error())
+		}
+
+		// manifest could be of another region, where the placements of the
+		// cluster don't exist
+		for key := range machines {
+			manifest.Default.Apply(&machines[key].Machine.Instance)
+			if manifest.Default.AvailableZone != "" {
+				machines[key].Placements = nil
+				machines[key].NodePlacements = nil
+			}
+		}
 	}
 
-	if clusters.Default.AvailableZone == "" {
-		if clusters.Default.DefaultAvailableZone != "" {
-			clusters.Default.AvailableZone = clusters.Default.DefaultAvailableZone
+	var authInfo aws.Auth
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
 		}
 	}
 
-	// First verify if I can open all machine files
-	machines := make([]Cluster, len(clusters.Clusters))
-	for key := range clusters.Clusters {
-		clusterConfig := &clusters.Clusters[key]
+	machine.SetLogger(ioutil.Discard, "", 0)
+	retry.SetLogger(os.Stderr, "", 0)
 
-		machineContent, err := ioutil.ReadFile(clusterConfig.Machine)
+	if *restore != "" {
+		err = verifySnapshots(manifest, machines, authInfo)
 		if err != nil {
-			logger.Fatal("Error open machine file: %s", err.Error())
+			logger.Fatal("Error verifying snapshot manifest: %s", err.Error())
 		}
 
-		var machineConfig machine.Machine
-		err = yaml.Unmarshal(machineContent, &machineConfig)
+		err = verifyRestoredNodes(manifest, machines, authInfo)
 		if err != nil {
-			logger.Fatal("Error reading machine file: %s", err.Error())
+			logger.Fatal("Error verifying snapshot manifest: %s", err.Error())
 		}
+	}
+
+	// nodes created are available to the cloud-config of the next clusters
+	outputs := make(map[string][]instance.ClusterNode)
 
-		// Verify if cloud-config file exists
-		if machineConfig.Instance.CloudConfig != "" {
-			_, err := os.Stat(machineConfig.Instance.CloudConfig)
+	for key, clusterConfig := range machines {
+		fmt.Printf("================ Running machines of %d. cluster ================\n", key+1)
+
+		existing, err := clusterConfig.Instances(authInfo)
+		if err != nil {
+			logger.Fatal("Error finding nodes of cluster <%s>: %s", clusterConfig.Name, err.Error())
+		}
+
+		err = rollingUpdate(clusterConfig, existing, outputs, authInfo)
+		if err != nil {
+			logger.Fatal("Error updating nodes of cluster <%s>, the remaining nodes were not updated: %s", clusterConfig.Name, err.Error())
+		}
+
+		for i := 1; i <= clusterConfig.Nodes; i++ {
+			if instanceInfo, ok := existing[i]; ok {
+				// a stopped node is still the node, it's not created again
+				if stopped(instanceInfo) {
+					fmt.Printf("Machine %s is %s, Id <%s>, use machine-ctl start to start it\n", instanceInfo.Name, instanceInfo.State.Name, instanceInfo.ID)
+				} else {
+					fmt.Printf("Machine %s is already running, Id <%s>, IP Address <%s>\n", instanceInfo.Name, instanceInfo.ID, instanceInfo.PrivateIPAddress)
+				}
+				outputs[clusterConfig.Name] = append(outputs[clusterConfig.Name], instance.ClusterNode{
+					Index:         i,
+					Name:          instanceInfo.Name,
+					ID:            instanceInfo.ID,
+					PrivateIP:     instanceInfo.PrivateIPAddress,
+					PublicIP:      instanceInfo.IPAddress,
+					AvailableZone: instanceInfo.AvailableZone,
+				})
+				continue
+			}
+
+			machineConfig, err := nodeConfig(clusterConfig, i, outputs)
 			if err != nil {
-				logger.Fatal("Error reading cloud-config: %s", err.Error())
+				logger.Fatal("Error getting node %d of cluster <%s>: %s", i, clusterConfig.Name, err.Error())
+			}
+
+			// restored volumes are always created from the snapshot
+			for k, volumeConfig := range clusterConfig.Machine.Volumes {
+				snapshotID := manifest.SnapshotID(clusterConfig.Name, i, volumeConfig.Name)
+				if snapshotID != "" {
+					machineConfig.Volumes[k].ID = ""
+					machineConfig.Volumes[k].SnapshotID = snapshotID
+				}
+			}
+
+			fmt.Printf("Running machine: %s\n", machineConfig.Instance.Name)
+			err = getMachine(&machineConfig, authInfo)
+			if err != nil {
+				logger.Fatal("Error getting machine: %s", err.Error())
+			}
+
+			outputs[clusterConfig.Name] = append(outputs[clusterConfig.Name], instance.ClusterNode{
+				Index:         i,
+				Name:          machineConfig.Instance.Name,
+				ID:            machineConfig.Instance.ID,
+				PrivateIP:     machineConfig.Instance.PrivateIPAddress,
+				PublicIP:      machineConfig.Instance.IPAddress,
+				AvailableZone: machineConfig.Instance.AvailableZone,
+			})
+
+			fmt.Printf("Machine Id <%s>, IP Address <%s>\n", machineConfig.Instance.ID, machineConfig.Instance.PrivateIPAddress)
+			if i < clusterConfig.Nodes {
+				fmt.Println("----------------------------------")
 			}
 		}
 
-		// Set default values of cluster to machine
-		if machineConfig.Instance.ImageID == "" {
-			machineConfig.Instance.ImageID = clusters.Default.ImageID
+		err = scaleDown(clusterConfig, existing, authInfo)
+		if err != nil {
+			logger.Fatal("Error removing nodes of cluster <%s>: %s", clusterConfig.Name, err.Error())
 		}
-		if machineConfig.Instance.Region == "" {
-			machineConfig.Instance.Region = clusters.Default.Region
+	}
+	fmt.Println("================================================================")
+}
+
+// nodeConfig returns the machine of a node with the options of the command
+func nodeConfig(clusterConfig cluster.Cluster, index int, outputs map[string][]instance.ClusterNode) (machine.Machine, error) {
+	machineConfig, err := clusterConfig.Node(index)
+	if err != nil {
+		return machineConfig, err
+	}
+
+	machineConfig.Options.AllowDowntime = *allowDowntime
+	machineConfig.Options.Replace = *replace
+	machineConfig.Options.UndoFallback = *undoFallback
+	machineConfig.Instance.UserData.Clusters = outputs
+
+	return machineConfig, nil
+}
+
+// rollingUpdate updates the existing nodes that need it, maxunavailable nodes
+// at a time. The next nodes are updated only after the updated nodes pass the
+// health check, otherwise the rollout is halted.
+func rollingUpdate(clusterConfig cluster.Cluster, existing map[int]instance.Instance, outputs map[string][]instance.ClusterNode, authInfo aws.Auth) error {
+	pending := make([]int, 0)
+	for i := 1; i <= clusterConfig.Nodes; i++ {
+		instanceInfo, ok := existing[i]
+		if !ok {
+			continue
 		}
-		if machineConfig.Instance.KeyName == "" {
-			machineConfig.Instance.KeyName = clusters.Default.KeyName
+
+		// the health check of a stopped node would halt the rollout
+		if stopped(instanceInfo) {
+			fmt.Printf("Machine %s is %s, it's not updated\n", instanceInfo.Name, instanceInfo.State.Name)
+			continue
 		}
-		if len(machineConfig.Instance.SecurityGroups) == 0 {
-			machineConfig.Instance.SecurityGroups = clusters.Default.SecurityGroups
+
+		machineConfig, err := nodeConfig(clusterConfig, i, outputs)
+		if err != nil {
+			return err
 		}
-		if machineConfig.Instance.SubnetID == "" {
-			machineConfig.Instance.SubnetID = clusters.Default.SubnetID
+
+		if needsUpdate(machineConfig, instanceInfo) {
+			pending = append(pending, i)
 		}
+	}
 
-		if machineConfig.Instance.AvailableZone == "" {
-			if machineConfig.Instance.DefaultAvailableZone != "" {
-				machineConfig.Instance.AvailableZone = machineConfig.Instance.DefaultAvailableZone
-			} else {
-				machineConfig.Instance.AvailableZone = clusters.Default.AvailableZone
-			}
+	ec2Ref := machine.EC2(clusterConfig.Machine.Instance.Region, authInfo)
+	for start := 0; start < len(pending); start += clusterConfig.MaxUnavailable {
+		end := start + clusterConfig.MaxUnavailable
+		if end > len(pending) {
+			end = len(pending)
 		}
 
-		for _, tag := range clusters.Default.Tags {
-			addTag := true
-			for _, instanceTag := range machineConfig.Instance.Tags {
-				if strings.EqualFold(instanceTag.Key, tag.Key) {
-					addTag = false
-				}
-			}
+		batch := pending[start:end]
+		updated := make([]instance.Instance, len(batch))
+		results := make([]error, len(batch))
 
-			if addTag {
-				machineConfig.Instance.Tags = append(machineConfig.Instance.Tags, tag)
-			}
+		var wg sync.WaitGroup
+		for key, index := range batch {
+			wg.Add(1)
+			go func(key, index int) {
+				defer wg.Done()
 
-			addTag = true
-			for k, volume := range machineConfig.Volumes {
-				for _, volumeTag := range volume.Tags {
-					if strings.EqualFold(volumeTag.Key, tag.Key) {
-						addTag = false
-					}
+				machineConfig, err := nodeConfig(clusterConfig, index, outputs)
+				if err != nil {
+					results[key] = err
+					return
+				}
 
+				updated[key], err = updateNode(&machineConfig, existing[index], authInfo)
+				if err != nil {
+					results[key] = err
+					return
 				}
 
-				if addTag {
-					machineConfig.Volumes[k].Tags = append(machineConfig.Volumes[k].Tags, tag)
+				fmt.Printf("Waiting machine %s be healthy\n", updated[key].Name)
+				err = instance.WaitUntilHealthy(ec2Ref, updated[key], clusterConfig.HealthCheck)
+				if err != nil {
+					results[key] = instance.WithConsoleOutput(ec2Ref, updated[key], err)
 				}
+			}(key, index)
+		}
+		wg.Wait()
+
+		for key, index := range batch {
+			if results[key] != nil {
+				return fmt.Errorf("node %d: %s", index, results[key].Error())
 			}
+
+			existing[index] = updated[key]
+		}
+	}
+
+	return nil
+}
+
+// stopped returns true when the instance is stopped or stopping, cluster-up
+// doesn't start it
+func stopped(instanceInfo instance.Instance) bool {
+	return instanceInfo.State.Name == "stopping" || instanceInfo.State.Name == "stopped"
+}
+
+// needsUpdate returns true when the node must be updated and the update is
+// allowed by the options, or when the nodes must be rebooted. Updates that
+// aren't allowed are only shown.
+func needsUpdate(machineConfig machine.Machine, instanceInfo instance.Instance) bool {
+	if machineConfig.Instance.ImageID != "" && machineConfig.Instance.ImageID != instanceInfo.ImageID {
+		if machineConfig.Options.Replace {
+			return true
 		}
 
-		machines[key] = Cluster{Machine: machineConfig, Nodes: clusterConfig.Nodes}
+		fmt.Printf("Machine %s uses the image <%s> instead of <%s>, use -replace to replace it\n", instanceInfo.Name, instanceInfo.ImageID, machineConfig.Instance.ImageID)
 	}
 
-	var authInfo aws.Auth
+	if machineConfig.Instance.Type != "" && machineConfig.Instance.Type != instanceInfo.Type {
+		if !machineConfig.Options.UndoFallback && instance.RunsFallbackType(instanceInfo, machineConfig.Instance.Type) {
+			fmt.Printf("Machine %s was created as <%s> because aws didn't have capacity of <%s>, use -undo-fallback to change it\n", instanceInfo.Name, instanceInfo.Type, machineConfig.Instance.Type)
+		} else if !machineConfig.Options.AllowDowntime {
+			fmt.Printf("Machine %s is <%s> instead of <%s>, use -allow-downtime to change it\n", instanceInfo.Name, instanceInfo.Type, machineConfig.Instance.Type)
+		} else {
+			return true
+		}
+	}
 
-	if *accessKey != "" && *secretKey != "" {
-		authInfo.AccessKey = *accessKey
-		authInfo.SecretKey = *secretKey
-	} else {
-		authInfo, err = auth.Aws()
+	return *reboot
+}
+
+// updateNode replaces the instance of an existing node when its image is
+// different, changes its type or reboots it, following the options, and
+// returns the instance of the node
+func updateNode(machineConfig *machine.Machine, instanceInfo instance.Instance, authInfo aws.Auth) (instance.Instance, error) {
+	machineConfig.Instance.ID = instanceInfo.ID
 
+	if machineConfig.Options.Replace && machineConfig.Instance.ImageID != "" && machineConfig.Instance.ImageID != instanceInfo.ImageID {
+		fmt.Printf("Replacing machine %s of image <%s> by a new one of image <%s>\n", instanceInfo.Name, instanceInfo.ImageID, machineConfig.Instance.ImageID)
+		err := machine.Replace(machineConfig, authInfo)
 		if err != nil {
-			logger.Fatal("Error reading aws credentials: %s", err.Error())
+			return instanceInfo, err
 		}
+
+		fmt.Printf("Machine %s was replaced, Id <%s>, IP Address <%s>\n", machineConfig.Instance.Name, machineConfig.Instance.ID, machineConfig.Instance.PrivateIPAddress)
+		return machineConfig.Instance, nil
 	}
 
-	machine.SetLogger(ioutil.Discard, "", 0)
+	changeType := machineConfig.Instance.Type != "" && machineConfig.Instance.Type != instanceInfo.Type &&
+		(machineConfig.Options.UndoFallback || !instance.RunsFallbackType(instanceInfo, machineConfig.Instance.Type))
+	if machineConfig.Options.AllowDowntime && changeType {
+		fmt.Printf("Changing type of machine %s from <%s> to <%s>\n", instanceInfo.Name, instanceInfo.Type, machineConfig.Instance.Type)
+		err := machine.ChangeType(machineConfig, authInfo)
+		if err != nil {
+			return instanceInfo, err
+		}
 
-	for key, clusterConfig := range machines {
-		fmt.Printf("================ Running machines of %d. cluster ================\n", key+1)
+		return machineConfig.Instance, nil
+	}
 
-		for i := 1; i <= clusterConfig.Nodes; i++ {
-			machineConfig := clusterConfig.Machine
-			machineConfig.Volumes = make([]volume.Volume, len(machineConfig.Volumes))
+	fmt.Printf("Rebooting machine %s\n", instanceInfo.Name)
+	err := instance.Reboot(machine.EC2(machineConfig.Instance.Region, authInfo), instanceInfo)
+	return instanceInfo, err
+}
 
-			// append machine number to name of instance
-			machineConfig.Instance.Name += fmt.Sprintf("-%d", i)
+// scaleDown destroys the nodes above the number of nodes of the cluster, from
+// the highest node number, following the ondestroy of the volumes
+func scaleDown(clusterConfig cluster.Cluster, existing map[int]instance.Instance, authInfo aws.Auth) error {
+	indexes := make([]int, 0)
+	for index := range existing {
+		if index > clusterConfig.Nodes {
+			indexes = append(indexes, index)
+		}
+	}
+
+	if len(indexes) == 0 {
+		return nil
+	}
 
-			// append machine number to name of volume
-			for key := range clusterConfig.Machine.Volumes {
-				volumeRef := &clusterConfig.Machine.Volumes[key]
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+
+	// a node that can't be terminated would be stopped and lose its volumes,
+	// so every node is checked before destroying any of them
+	machines := make([]machine.Machine, len(indexes))
+	for key, index := range indexes {
+		machineConfig, err := clusterConfig.Node(index)
+		if err != nil {
+			return err
+		}
+		machineConfig.Instance.ID = existing[index].ID
+
+		err = machine.CheckTermination(machineConfig, authInfo)
+		if err != nil {
+			return err
+		}
+
+		machines[key] = machineConfig
+	}
 
-				volumeConfig := *volumeRef
-				volumeConfig.Name += fmt.Sprintf("-%d", i)
-				machineConfig.Volumes[key] = volumeConfig
+	if !*yes {
+		names := make([]string, len(indexes))
+		for key, index := range indexes {
+			names[key] = existing[index].Name
+		}
+
+		fmt.Printf("The machines <%s> will be destroyed, are you sure? [y/N] ", strings.Join(names, ", "))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("The machines were kept")
+			return nil
+		}
+	}
+
+	for key := range machines {
+		fmt.Printf("Destroying machine: %s\n", existing[indexes[key]].Name)
+		err := machine.Destroy(&machines[key], authInfo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getMachine tries again when aws doesn't have capacity, all other errors
+// abort the cluster. Throttled requests were already repeated one by one, the
+// machine is not got again for them. Getting it again reuses the instance and
+// volumes created by the failed attempt, volumes not formatted yet keep the
+// formatted tag false, so they are formatted by the next attempt.
+func getMachine(machineConfig *machine.Machine, authInfo aws.Auth) error {
+	for attempt := 1; ; attempt++ {
+		err := machine.Get(machineConfig, authInfo)
+
+		var capacityError *errs.CapacityError
+		if err == nil || attempt >= maxAttempts || !errors.As(err, &capacityError) {
+			return err
+		}
+
+		fmt.Printf("Error getting machine, trying again in %s: %s\n", retryDelay, err.Error())
+		time.Sleep(retryDelay)
+	}
+}
+
+// verifySnapshots checks that the snapshots of the manifest are of the account,
+// in the region where each cluster is restored
+func verifySnapshots(manifest snapshot.Manifest, machines []cluster.Cluster, authInfo aws.Auth) error {
+	for _, clusterConfig := range machines {
+		ids := make([]string, 0)
+		for _, node := range manifest.Nodes {
+			if node.Cluster != clusterConfig.Name {
+				continue
 			}
 
-			fmt.Printf("Running machine: %s\n", machineConfig.Instance.Name)
-			err = machine.Get(&machineConfig, authInfo)
-			if err != nil {
-				logger.Fatal("Error getting machine: %s", err.Error())
+			for _, snapshotID := range node.Volumes {
+				ids = append(ids, snapshotID)
 			}
+		}
 
-			fmt.Printf("Machine Id <%s>, IP Address <%s>\n", machineConfig.Instance.ID, machineConfig.Instance.PrivateIPAddress)
-			if i < clusterConfig.Nodes {
-				fmt.Println("----------------------------------")
+		err := snapshot.VerifyOwned(machine.EC2(clusterConfig.Machine.Instance.Region, authInfo), ids)
+		if err != nil {
+			return fmt.Errorf("Cluster <%s>: %s", clusterConfig.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// verifyRestoredNodes checks that the nodes of the manifest don't have an
+// instance, only new nodes are created from the snapshots, so an existing node
+// would keep its volumes and nothing would be restored
+func verifyRestoredNodes(manifest snapshot.Manifest, machines []cluster.Cluster, authInfo aws.Auth) error {
+	for _, clusterConfig := range machines {
+		var existing map[int]instance.Instance
+		for _, node := range manifest.Nodes {
+			if node.Cluster != clusterConfig.Name {
+				continue
+			}
+
+			if existing == nil {
+				var err error
+				existing, err = clusterConfig.Instances(authInfo)
+				if err != nil {
+					return err
+				}
+			}
+
+			if instanceInfo, ok := existing[node.Node]; ok {
+				return fmt.Errorf("Node %d of cluster <%s> already has the instance <%s>, destroy it to restore its snapshots", node.Node, clusterConfig.Name, instanceInfo.ID)
 			}
 		}
 	}
-	fmt.Println("================================================================")
+
+	return nil
+}
+
+// verifyManifest checks if every node and volume of the manifest exists in the
+// clusters, otherwise some data would not be restored
+func verifyManifest(manifest snapshot.Manifest, machines []cluster.Cluster) error {
+	for _, node := range manifest.Nodes {
+		var clusterConfig *cluster.Cluster
+		for key := range machines {
+			if machines[key].Name == node.Cluster {
+				clusterConfig = &machines[key]
+				break
+			}
+		}
+
+		if clusterConfig == nil {
+			return fmt.Errorf("Cluster <%s> is not in the cluster file", node.Cluster)
+		}
+
+		if node.Node > clusterConfig.Nodes {
+			return fmt.Errorf("Cluster <%s> has only %d node(s), cannot restore node %d", node.Cluster, clusterConfig.Nodes, node.Node)
+		}
+
+		for volumeName := range node.Volumes {
+			found := false
+			for _, volumeConfig := range clusterConfig.Machine.Volumes {
+				if volumeConfig.Name == volumeName {
+					found = true
+				}
+			}
+
+			if !found {
+				return fmt.Errorf("Cluster <%s> doesn't have the volume <%s>", node.Cluster, volumeName)
+			}
+		}
+	}
+
+	return nil
 }
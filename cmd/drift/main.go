@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/cluster"
+	"github.com/NeowayLabs/cloud-machine/drift"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/logger"
+	"gopkg.in/amz.v3/aws"
+)
+
+// exitDrift is the exit code when some resource is not as in the files
+const exitDrift = 2
+
+var (
+	accessKey   = flag.String("access-key", "", "AWS Access Key")
+	secretKey   = flag.String("secret-key", "", "AWS Secret Key")
+	clusterMode = flag.Bool("cluster", false, "The file passed is a cluster file")
+	clusterName = flag.String("name", "", "Name of the cluster, default is all clusters")
+	jsonOutput  = flag.Bool("json", false, "Print the differences as json")
+)
+
+func main() {
+	flag.Parse()
+
+	file := flag.Arg(0)
+	if file == "" {
+		logger.Fatal("You need to pass a machine definition file, type: %s [-cluster] <machine.yml>\n", os.Args[0])
+	}
+
+	var machines []machine.Machine
+	if *clusterMode {
+		clusters, err := cluster.Load(file)
+		if err != nil {
+			logger.Fatal("%s", err.Error())
+		}
+
+		machines, err = cluster.Machines(clusters, *clusterName, 0)
+		if err != nil {
+			logger.Fatal("Error getting nodes: %s", err.Error())
+		}
+	} else {
+		machineConfig, err := machine.Load(file)
+		if err != nil {
+			logger.Fatal("Error reading machine file: %s", err.Error())
+		}
+
+		machines = append(machines, machineConfig)
+	}
+
+	var authInfo aws.Auth
+	var err error
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
+		}
+	}
+
+	machine.SetLogger(ioutil.Discard, "", 0)
+
+	differences := make([]drift.Difference, 0)
+	for _, machineConfig := range machines {
+		machineDifferences, err := drift.Machine(machineConfig, authInfo)
+		if err != nil {
+			logger.Fatal("Error loading machine <%s>: %s", machineConfig.Instance.Name, err.Error())
+		}
+
+		differences = append(differences, machineDifferences...)
+	}
+
+	if *jsonOutput {
+		content, err := json.MarshalIndent(differences, "", "  ")
+		if err != nil {
+			logger.Fatal("Error writing json: %s", err.Error())
+		}
+
+		fmt.Println(string(content))
+	} else if len(differences) == 0 {
+		fmt.Println("No drift was found")
+	} else {
+		for _, difference := range differences {
+			fmt.Println(difference.String())
+		}
+	}
+
+	if len(differences) > 0 {
+		os.Exit(exitDrift)
+	}
+}
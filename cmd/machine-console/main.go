@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/cluster"
+	"github.com/NeowayLabs/cloud-machine/instance"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/logger"
+	"gopkg.in/amz.v3/aws"
+)
+
+var (
+	accessKey   = flag.String("access-key", "", "AWS Access Key")
+	secretKey   = flag.String("secret-key", "", "AWS Secret Key")
+	clusterMode = flag.Bool("cluster", false, "The file passed is a cluster file")
+	clusterName = flag.String("name", "", "Name of the cluster, default is all clusters")
+	node        = flag.Int("node", 0, "Node number of the cluster, default is all nodes")
+	lines       = flag.Int("lines", 0, "Show only the last lines of the console output")
+)
+
+func main() {
+	flag.Parse()
+
+	file := flag.Arg(0)
+	if file == "" {
+		logger.Fatal("You need to pass a machine definition file, type: %s [-cluster] <machine.yml>\n", os.Args[0])
+	}
+
+	var machines []machine.Machine
+	if *clusterMode {
+		clusters, err := cluster.Load(file)
+		if err != nil {
+			logger.Fatal("%s", err.Error())
+		}
+
+		machines, err = cluster.Machines(clusters, *clusterName, *node)
+		if err != nil {
+			logger.Fatal("Error getting nodes: %s", err.Error())
+		}
+	} else {
+		machineConfig, err := machine.Load(file)
+		if err != nil {
+			logger.Fatal("Error reading machine file: %s", err.Error())
+		}
+
+		machines = append(machines, machineConfig)
+	}
+
+	var authInfo aws.Auth
+	var err error
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
+		}
+	}
+
+	machine.SetLogger(ioutil.Discard, "", 0)
+
+	for _, machineConfig := range machines {
+		fmt.Printf("================ Console output of %s ================\n", machineConfig.Instance.Name)
+
+		err = machine.Lookup(&machineConfig, authInfo)
+		if err != nil {
+			logger.Fatal("Error loading machine <%s>: %s", machineConfig.Instance.Name, err.Error())
+		}
+
+		if machineConfig.Instance.ID == "" {
+			fmt.Println("Machine doesn't have an instance")
+			continue
+		}
+
+		ec2Ref := machine.EC2(machineConfig.Instance.Region, authInfo)
+		output, err := instance.ConsoleOutput(ec2Ref, machineConfig.Instance)
+		if err != nil {
+			logger.Fatal("Error getting console output of instance <%s>: %s", machineConfig.Instance.ID, err.Error())
+		}
+
+		if output == "" {
+			fmt.Printf("Instance <%s> doesn't have console output yet\n", machineConfig.Instance.ID)
+			continue
+		}
+
+		fmt.Println(instance.Tail(output, *lines))
+	}
+}
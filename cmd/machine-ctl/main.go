@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/cluster"
+	"github.com/NeowayLabs/cloud-machine/instance"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/logger"
+	"gopkg.in/amz.v3/aws"
+)
+
+var (
+	accessKey   = flag.String("access-key", "", "AWS Access Key")
+	secretKey   = flag.String("secret-key", "", "AWS Secret Key")
+	clusterMode = flag.Bool("cluster", false, "The file passed is a cluster file")
+	clusterName = flag.String("name", "", "Name of the cluster, default is all clusters")
+	node        = flag.Int("node", 0, "Node number of the cluster, default is all nodes")
+)
+
+func main() {
+	flag.Parse()
+
+	action := flag.Arg(0)
+	file := flag.Arg(1)
+	if file == "" {
+		logger.Fatal("You need to pass an action and a machine definition file, type: %s [-cluster [-name <cluster>] [-node <n>]] <stop|start|reboot> <machine.yml>\n", os.Args[0])
+	}
+
+	if action != "stop" && action != "start" && action != "reboot" {
+		logger.Fatal("Invalid action <%s>, it must be stop, start or reboot", action)
+	}
+
+	var machines []machine.Machine
+	if *clusterMode {
+		clusters, err := cluster.Load(file)
+		if err != nil {
+			logger.Fatal("%s", err.Error())
+		}
+
+		machines, err = cluster.Machines(clusters, *clusterName, *node)
+		if err != nil {
+			logger.Fatal("Error getting nodes: %s", err.Error())
+		}
+	} else {
+		machineConfig, err := machine.Load(file)
+		if err != nil {
+			logger.Fatal("Error reading machine file: %s", err.Error())
+		}
+
+		machines = append(machines, machineConfig)
+	}
+
+	var authInfo aws.Auth
+	var err error
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
+		}
+	}
+
+	machine.SetLogger(ioutil.Discard, "", 0)
+
+	// clusters are loaded in dependency order, they are started in this order
+	// and stopped in the reverse order, so a node stops after its dependents
+	if action == "stop" {
+		for i, j := 0, len(machines)-1; i < j; i, j = i+1, j-1 {
+			machines[i], machines[j] = machines[j], machines[i]
+		}
+	}
+
+	for _, machineConfig := range machines {
+		err = machine.Lookup(&machineConfig, authInfo)
+		if err != nil {
+			logger.Fatal("Error loading machine <%s>: %s", machineConfig.Instance.Name, err.Error())
+		}
+
+		if machineConfig.Instance.ID == "" {
+			fmt.Printf("Machine %s doesn't have an instance\n", machineConfig.Instance.Name)
+			continue
+		}
+
+		err = run(action, machineConfig, authInfo)
+		if err != nil {
+			logger.Fatal("Error on %s of machine <%s>: %s", action, machineConfig.Instance.Name, err.Error())
+		}
+	}
+}
+
+// run the action on the instance of the machine and wait until it is done,
+// instances already in the state of the action are skipped
+func run(action string, machineConfig machine.Machine, authInfo aws.Auth) error {
+	ec2Ref := machine.EC2(machineConfig.Instance.Region, authInfo)
+	instanceInfo := &machineConfig.Instance
+
+	switch action {
+	case "stop":
+		if instanceInfo.State.Name == "stopped" {
+			fmt.Printf("Machine %s is already stopped\n", instanceInfo.Name)
+			return nil
+		}
+
+		fmt.Printf("Stopping machine %s <%s>\n", instanceInfo.Name, instanceInfo.ID)
+		err := instance.Stop(ec2Ref, instanceInfo)
+		if err != nil {
+			return err
+		}
+	case "start":
+		if instanceInfo.State.Name == "running" {
+			fmt.Printf("Machine %s is already running\n", instanceInfo.Name)
+			return nil
+		}
+
+		// a stopping instance can't be started yet
+		if instanceInfo.State.Name == "stopping" {
+			err := instance.WaitUntilState(ec2Ref, instanceInfo, "stopped")
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("Starting machine %s <%s>\n", instanceInfo.Name, instanceInfo.ID)
+		err := instance.Start(ec2Ref, instanceInfo)
+		if err != nil {
+			return err
+		}
+
+		err = instance.WaitUntilHealthy(ec2Ref, *instanceInfo, instanceInfo.Readiness)
+		if err != nil {
+			return instance.WithConsoleOutput(ec2Ref, *instanceInfo, err)
+		}
+	case "reboot":
+		if instanceInfo.State.Name != "running" {
+			return fmt.Errorf("The instance <%s> is <%s>, only running instances can be rebooted", instanceInfo.ID, instanceInfo.State.Name)
+		}
+
+		fmt.Printf("Rebooting machine %s <%s>\n", instanceInfo.Name, instanceInfo.ID)
+		err := instance.Reboot(ec2Ref, *instanceInfo)
+		if err != nil {
+			return err
+		}
+
+		err = instance.WaitUntilHealthy(ec2Ref, *instanceInfo, instanceInfo.Readiness)
+		if err != nil {
+			return instance.WithConsoleOutput(ec2Ref, *instanceInfo, err)
+		}
+	}
+
+	fmt.Printf("Machine %s is %s\n", instanceInfo.Name, instanceInfo.State.Name)
+	return nil
+}
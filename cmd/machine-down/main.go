@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/logger"
+	"gopkg.in/amz.v3/aws"
+)
+
+var (
+	accessKey = flag.String("access-key", "", "AWS Access Key")
+	secretKey = flag.String("secret-key", "", "AWS Secret Key")
+	yes       = flag.Bool("yes", false, "Destroy the machine without asking for confirmation")
+)
+
+func main() {
+	flag.Parse()
+
+	machineFile := flag.Arg(0)
+	if machineFile == "" {
+		logger.Fatal("You need to pass a machine definition file, type: %s <machine.yml>\n", os.Args[0])
+	}
+
+	machineConfig, err := machine.Load(machineFile)
+	if err != nil {
+		logger.Fatal("Error reading machine file: %s", err.Error())
+	}
+
+	var authInfo aws.Auth
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
+		}
+	}
+
+	if !*yes {
+		fmt.Printf("The machine <%s> will be destroyed, are you sure? [y/N] ", machineConfig.Instance.Name)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			logger.Fatal("Aborted")
+		}
+	}
+
+	err = machine.Destroy(&machineConfig, authInfo)
+	if err != nil {
+		logger.Fatal("Error destroying machine: %s", err.Error())
+	}
+}
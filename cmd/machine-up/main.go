@@ -13,8 +13,11 @@ import (
 )
 
 var (
-	accessKey = flag.String("access-key", "", "AWS Access Key")
-	secretKey = flag.String("secret-key", "", "AWS Secret Key")
+	accessKey     = flag.String("access-key", "", "AWS Access Key")
+	secretKey     = flag.String("secret-key", "", "AWS Secret Key")
+	allowDowntime = flag.Bool("allow-downtime", false, "Stop the instance to change its type")
+	replace       = flag.Bool("replace", false, "Replace the instance when its image is different")
+	undoFallback  = flag.Bool("undo-fallback", false, "Change the type of the instance created with a fallback type too")
 )
 
 func main() {
@@ -57,6 +60,17 @@ func main() {
 		}
 	}
 
+	machineConfig.Options.AllowDowntime = *allowDowntime
+	machineConfig.Options.Replace = *replace
+	machineConfig.Options.UndoFallback = *undoFallback
+
+	if *replace {
+		err = machine.Replace(&machineConfig, authInfo)
+		if err != nil {
+			logger.Fatal("Error replacing machine: %s", err.Error())
+		}
+	}
+
 	err = machine.Get(&machineConfig, authInfo)
 	if err != nil {
 		logger.Fatal("Error getting machine: %s", err.Error())
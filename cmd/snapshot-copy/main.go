@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/cluster"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/cloud-machine/snapshot"
+	"github.com/NeowayLabs/cloud-machine/tags"
+	"github.com/NeowayLabs/logger"
+	"gopkg.in/amz.v3/aws"
+	"gopkg.in/amz.v3/ec2"
+)
+
+var (
+	accessKey      = flag.String("access-key", "", "AWS Access Key")
+	secretKey      = flag.String("secret-key", "", "AWS Secret Key")
+	region         = flag.String("region", "", "Region where the snapshots will be copied to")
+	manifestFile   = flag.String("manifest", "", "File where the snapshot manifest will be written")
+	availableZone  = flag.String("availablezone", "", "Available zone used to restore the cluster in the target region")
+	imageID        = flag.String("imageid", "", "Image Id used to restore the cluster in the target region")
+	keyName        = flag.String("keyname", "", "Key name used to restore the cluster in the target region")
+	subnetID       = flag.String("subnetid", "", "Subnet Id used to restore the cluster in the target region")
+	securityGroups = flag.String("securitygroups", "", "Comma separated security group Ids used to restore the cluster in the target region")
+)
+
+func main() {
+	flag.Parse()
+
+	clusterFile := flag.Arg(0)
+	if clusterFile == "" {
+		logger.Fatal("You need to pass the cluster file, type: %s -region <region> -manifest <manifest.yml> <cluster-file.yml>\n", os.Args[0])
+	}
+
+	if *region == "" || *manifestFile == "" {
+		logger.Fatal("You need to pass the target region and the manifest file, type: %s -region <region> -manifest <manifest.yml> <cluster-file.yml>\n", os.Args[0])
+	}
+
+	machines, err := cluster.Load(clusterFile)
+	if err != nil {
+		logger.Fatal("%s", err.Error())
+	}
+
+	var authInfo aws.Auth
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
+		}
+	}
+
+	manifest := snapshot.Manifest{
+		Default: snapshot.Default{
+			Region:        *region,
+			AvailableZone: *availableZone,
+			ImageID:       *imageID,
+			KeyName:       *keyName,
+			SubnetID:      *subnetID,
+		},
+	}
+
+	if *securityGroups != "" {
+		manifest.Default.SecurityGroups = strings.Split(*securityGroups, ",")
+	}
+
+	targetRef := machine.EC2(*region, authInfo)
+
+	for _, clusterConfig := range machines {
+		fmt.Printf("================ Copying snapshots of cluster %s ================\n", clusterConfig.Name)
+
+		sourceRegion := clusterConfig.Machine.Instance.Region
+		sourceRef := machine.EC2(sourceRegion, authInfo)
+		snapshots, err := snapshot.Find(sourceRef, []ec2.Tag{{Key: tags.Cluster, Value: clusterConfig.Name}})
+		if err != nil {
+			logger.Fatal("Error finding snapshots: %s", err.Error())
+		}
+
+		// only the newest completed snapshot of each volume is copied
+		snapshot.Sort(snapshots)
+		nodes := make(map[int]*snapshot.Node)
+		for _, snapshotInfo := range snapshots {
+			if snapshotInfo.Status != "completed" {
+				continue
+			}
+
+			node, err := strconv.Atoi(tags.Get(snapshotInfo.Tags, tags.Node))
+			volumeName := tags.Get(snapshotInfo.Tags, tags.Volume)
+			if err != nil || volumeName == "" {
+				fmt.Printf("Snapshot <%s> doesn't have node and volume tags, skipping\n", snapshotInfo.Id)
+				continue
+			}
+
+			if nodes[node] == nil {
+				nodes[node] = &snapshot.Node{Cluster: clusterConfig.Name, Node: node, Volumes: make(map[string]string)}
+			}
+
+			if nodes[node].Volumes[volumeName] != "" {
+				continue
+			}
+
+			fmt.Printf("Copying snapshot <%s> of node %d, volume %s\n", snapshotInfo.Id, node, volumeName)
+			copied, err := snapshot.Copy(targetRef, sourceRegion, snapshotInfo)
+			if err != nil {
+				logger.Fatal("Error copying snapshot: %s", err.Error())
+			}
+
+			fmt.Printf("Snapshot <%s> copied to <%s> in %s\n", snapshotInfo.Id, copied.Id, *region)
+			nodes[node].Volumes[volumeName] = copied.Id
+		}
+
+		for i := 1; i <= clusterConfig.Nodes; i++ {
+			if nodes[i] != nil {
+				manifest.Nodes = append(manifest.Nodes, *nodes[i])
+			} else {
+				fmt.Printf("Node %d doesn't have snapshots\n", i)
+			}
+		}
+	}
+
+	err = snapshot.SaveManifest(*manifestFile, manifest)
+	if err != nil {
+		logger.Fatal("Error writing snapshot manifest: %s", err.Error())
+	}
+
+	fmt.Printf("Snapshot manifest written to %s\n", *manifestFile)
+	fmt.Println("================================================================")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/cluster"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/cloud-machine/snapshot"
+	"github.com/NeowayLabs/cloud-machine/tags"
+	"github.com/NeowayLabs/logger"
+	"gopkg.in/amz.v3/aws"
+	"gopkg.in/amz.v3/ec2"
+)
+
+var (
+	accessKey = flag.String("access-key", "", "AWS Access Key")
+	secretKey = flag.String("secret-key", "", "AWS Secret Key")
+	dryRun    = flag.Bool("dry-run", false, "Only show the snapshots that would be deleted")
+)
+
+func main() {
+	flag.Parse()
+
+	clusterFile := flag.Arg(0)
+	if clusterFile == "" {
+		logger.Fatal("You need to pass the cluster file, type: %s <cluster-file.yml>\n", os.Args[0])
+	}
+
+	machines, err := cluster.Load(clusterFile)
+	if err != nil {
+		logger.Fatal("%s", err.Error())
+	}
+
+	var authInfo aws.Auth
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
+		}
+	}
+
+	now := time.Now()
+	for _, clusterConfig := range machines {
+		fmt.Printf("================ Pruning snapshots of cluster %s ================\n", clusterConfig.Name)
+
+		if clusterConfig.Retention.Empty() {
+			fmt.Println("Cluster doesn't have a retention policy, skipping")
+			continue
+		}
+
+		ec2Ref := machine.EC2(clusterConfig.Machine.Instance.Region, authInfo)
+		snapshots, err := snapshot.Find(ec2Ref, []ec2.Tag{{Key: tags.Cluster, Value: clusterConfig.Name}})
+		if err != nil {
+			logger.Fatal("Error finding snapshots: %s", err.Error())
+		}
+
+		// the retention policy is applied to the snapshots of each volume
+		series := make(map[string][]ec2.Snapshot)
+		for _, snapshotInfo := range snapshots {
+			key := fmt.Sprintf("node %s, volume %s", tags.Get(snapshotInfo.Tags, tags.Node), tags.Get(snapshotInfo.Tags, tags.Volume))
+			series[key] = append(series[key], snapshotInfo)
+		}
+
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			expired, err := clusterConfig.Retention.Expired(series[key], now)
+			if err != nil {
+				logger.Fatal("Error applying retention policy: %s", err.Error())
+			}
+
+			fmt.Printf("%s: %d snapshot(s), %d expired\n", key, len(series[key]), len(expired))
+			for _, snapshotInfo := range expired {
+				fmt.Printf("    %s %s\n", snapshotInfo.Id, snapshotInfo.StartTime)
+			}
+
+			if *dryRun || len(expired) == 0 {
+				continue
+			}
+
+			err = snapshot.Delete(ec2Ref, expired)
+			if err != nil {
+				logger.Fatal("Error deleting snapshots: %s", err.Error())
+			}
+		}
+	}
+	fmt.Println("================================================================")
+}
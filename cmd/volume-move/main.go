@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/NeowayLabs/cloud-machine/auth"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/logger"
+	"gopkg.in/amz.v3/aws"
+)
+
+var (
+	accessKey  = flag.String("access-key", "", "AWS Access Key")
+	secretKey  = flag.String("secret-key", "", "AWS Secret Key")
+	volumeName = flag.String("volume", "", "Name of the volume in the source machine file")
+	stop       = flag.Bool("stop", false, "Stop the source instance before detaching the volume")
+)
+
+func main() {
+	flag.Parse()
+
+	fromFile := flag.Arg(0)
+	toFile := flag.Arg(1)
+	if fromFile == "" || toFile == "" || *volumeName == "" {
+		logger.Fatal("You need to pass the volume name and the machine files, type: %s -volume <name> <from-machine.yml> <to-machine.yml>\n", os.Args[0])
+	}
+
+	from, err := machine.Load(fromFile)
+	if err != nil {
+		logger.Fatal("Error reading machine file: %s", err.Error())
+	}
+
+	to, err := machine.Load(toFile)
+	if err != nil {
+		logger.Fatal("Error reading machine file: %s", err.Error())
+	}
+
+	var authInfo aws.Auth
+
+	if *accessKey != "" && *secretKey != "" {
+		authInfo.AccessKey = *accessKey
+		authInfo.SecretKey = *secretKey
+	} else {
+		authInfo, err = auth.Aws()
+
+		if err != nil {
+			logger.Fatal("Error reading aws credentials: %s", err.Error())
+		}
+	}
+
+	err = machine.MoveVolume(&from, &to, *volumeName, *stop, authInfo)
+	if err != nil {
+		logger.Fatal("Error moving volume: %s", err.Error())
+	}
+}
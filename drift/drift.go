@@ -0,0 +1,150 @@
+package drift
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NeowayLabs/cloud-machine/instance"
+	"github.com/NeowayLabs/cloud-machine/machine"
+	"github.com/NeowayLabs/cloud-machine/tags"
+	"github.com/NeowayLabs/cloud-machine/volume"
+	"gopkg.in/amz.v3/aws"
+	"gopkg.in/amz.v3/ec2"
+)
+
+// Difference is a field of an instance or volume that is not as in the
+// machine file
+type Difference struct {
+	Resource string `json:"resource"` // instance or volume
+	Name     string `json:"name"`
+	ID       string `json:"id"`
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+func (difference Difference) String() string {
+	if difference.Field == "exists" {
+		return fmt.Sprintf("%s %s doesn't exist", difference.Resource, difference.Name)
+	}
+
+	return fmt.Sprintf("%s %s <%s>: %s is <%s>, expected <%s>", difference.Resource, difference.Name, difference.ID, difference.Field, difference.Actual, difference.Expected)
+}
+
+// Machine loads the instance and volumes of the machine and returns the
+// fields that are different from the machine file. Empty fields of the
+// machine file are not compared, neither the tags that aren't in it.
+func Machine(machineConfig machine.Machine, auth aws.Auth) ([]Difference, error) {
+	live := machineConfig
+	live.Volumes = make([]volume.Volume, len(machineConfig.Volumes))
+	copy(live.Volumes, machineConfig.Volumes)
+
+	err := machine.Lookup(&live, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	// the loaded instance has the id of the instance profile, it's compared
+	// by its arn
+	if live.Instance.ID != "" && machineConfig.Instance.IAM != "" {
+		live.Instance.IAM, err = instance.InstanceProfile(machine.EC2(machineConfig.Instance.Region, auth), live.Instance)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	differences := Instance(machineConfig.Instance, live.Instance)
+	for key := range machineConfig.Volumes {
+		differences = append(differences, Volume(machineConfig.Volumes[key], live.Volumes[key])...)
+	}
+
+	return differences, nil
+}
+
+// Instance compares the instance of the machine file with the live instance
+func Instance(expected, actual instance.Instance) []Difference {
+	if actual.ID == "" {
+		return []Difference{{Resource: "instance", Name: expected.Name, Field: "exists", Expected: "true", Actual: "false"}}
+	}
+
+	differences := make([]Difference, 0)
+	add := func(field, expectedValue, actualValue string) {
+		if expectedValue != "" && expectedValue != actualValue {
+			differences = append(differences, Difference{Resource: "instance", Name: expected.Name, ID: actual.ID, Field: field, Expected: expectedValue, Actual: actualValue})
+		}
+	}
+
+	// a fallback type was chosen on purpose, it's not a drift
+	if !instance.RunsFallbackType(actual, expected.Type) {
+		add("type", expected.Type, actual.Type)
+	}
+	add("imageid", expected.ImageID, actual.ImageID)
+	if len(expected.SecurityGroups) > 0 {
+		add("securitygroups", joinSorted(expected.SecurityGroups), joinSorted(actual.SecurityGroups))
+	}
+
+	// the live instance has the arn of the instance profile, the file can
+	// have only its name
+	if expected.IAM != "" && actual.IAM != expected.IAM && !strings.HasSuffix(actual.IAM, "/"+expected.IAM) {
+		add("iam", expected.IAM, actual.IAM)
+	}
+
+	add("name", expected.Name, actual.Name)
+	for _, tag := range compareTags(expected.Tags, actual.Tags) {
+		add("tag "+tag.Key, tag.Value, tags.Get(actual.Tags, tag.Key))
+	}
+
+	return differences
+}
+
+// Volume compares the volume of the machine file with the live volume
+func Volume(expected, actual volume.Volume) []Difference {
+	if actual.ID == "" {
+		return []Difference{{Resource: "volume", Name: expected.Name, Field: "exists", Expected: "true", Actual: "false"}}
+	}
+
+	differences := make([]Difference, 0)
+	add := func(field, expectedValue, actualValue string) {
+		if expectedValue != "" && expectedValue != actualValue {
+			differences = append(differences, Difference{Resource: "volume", Name: expected.Name, ID: actual.ID, Field: field, Expected: expectedValue, Actual: actualValue})
+		}
+	}
+
+	add("type", expected.Type, actual.Type)
+	if expected.Size > 0 {
+		add("size", strconv.Itoa(expected.Size), strconv.Itoa(actual.Size))
+	}
+	if expected.IOPS > 0 && expected.Type == "io1" {
+		add("iops", strconv.FormatInt(expected.IOPS, 10), strconv.FormatInt(actual.IOPS, 10))
+	}
+
+	add("name", expected.Name, actual.Name)
+	for _, tag := range compareTags(expected.Tags, actual.Tags) {
+		add("tag "+tag.Key, tag.Value, tags.Get(actual.Tags, tag.Key))
+	}
+
+	return differences
+}
+
+// compareTags returns the expected tags that have another value or are
+// missing in actual
+func compareTags(expected, actual []ec2.Tag) []ec2.Tag {
+	different := make([]ec2.Tag, 0)
+	for _, tag := range expected {
+		if tags.Get(actual, tag.Key) != tag.Value {
+			different = append(different, tag)
+		}
+	}
+
+	return different
+}
+
+func joinSorted(values []string) string {
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+	sort.Strings(sorted)
+
+	return strings.Join(sorted, ",")
+}
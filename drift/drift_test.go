@@ -0,0 +1,125 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NeowayLabs/cloud-machine/instance"
+	"github.com/NeowayLabs/cloud-machine/tags"
+	"github.com/NeowayLabs/cloud-machine/volume"
+	"gopkg.in/amz.v3/ec2"
+)
+
+func TestInstance(t *testing.T) {
+	expected := instance.Instance{
+		Name:           "mongo-1",
+		Type:           "m3.large",
+		ImageID:        "ami-2",
+		SecurityGroups: []string{"sg-2", "sg-1"},
+		IAM:            "mongo",
+		Tags:           []ec2.Tag{{Key: "env", Value: "prod"}},
+	}
+
+	live := func(change func(*instance.Instance)) instance.Instance {
+		actual := expected
+		actual.ID = "i-1"
+		actual.SecurityGroups = []string{"sg-1", "sg-2"}
+		actual.IAM = "arn:aws:iam::123456789012:instance-profile/mongo"
+		actual.Tags = []ec2.Tag{{Key: "env", Value: "prod"}, {Key: "team", Value: "data"}}
+		if change != nil {
+			change(&actual)
+		}
+		return actual
+	}
+
+	difference := func(field, expectedValue, actualValue string) Difference {
+		return Difference{Resource: "instance", Name: "mongo-1", ID: "i-1", Field: field, Expected: expectedValue, Actual: actualValue}
+	}
+
+	tests := []struct {
+		name     string
+		actual   instance.Instance
+		expected []Difference
+	}{
+		{"same", live(nil), []Difference{}},
+		{"missing", instance.Instance{}, []Difference{{Resource: "instance", Name: "mongo-1", Field: "exists", Expected: "true", Actual: "false"}}},
+		{"type", live(func(actual *instance.Instance) { actual.Type = "m3.medium" }), []Difference{difference("type", "m3.large", "m3.medium")}},
+		{"fallback type", live(func(actual *instance.Instance) {
+			actual.Type = "m4.large"
+			actual.Tags = tags.Set(actual.Tags, tags.RequestedType, "m3.large")
+		}), []Difference{}},
+		{"image", live(func(actual *instance.Instance) { actual.ImageID = "ami-1" }), []Difference{difference("imageid", "ami-2", "ami-1")}},
+		{"security groups", live(func(actual *instance.Instance) { actual.SecurityGroups = []string{"sg-3"} }), []Difference{difference("securitygroups", "sg-1,sg-2", "sg-3")}},
+		{"iam name", live(func(actual *instance.Instance) { actual.IAM = "mongo" }), []Difference{}},
+		{"iam", live(func(actual *instance.Instance) { actual.IAM = "arn:aws:iam::123456789012:instance-profile/other" }), []Difference{difference("iam", "mongo", "arn:aws:iam::123456789012:instance-profile/other")}},
+		{"iam suffix", live(func(actual *instance.Instance) { actual.IAM = "arn:aws:iam::123456789012:instance-profile/my-mongo" }), []Difference{difference("iam", "mongo", "arn:aws:iam::123456789012:instance-profile/my-mongo")}},
+		{"name", live(func(actual *instance.Instance) { actual.Name = "mongo-01" }), []Difference{difference("name", "mongo-1", "mongo-01")}},
+		{"tag", live(func(actual *instance.Instance) { actual.Tags = tags.Set(actual.Tags, "env", "dev") }), []Difference{difference("tag env", "prod", "dev")}},
+		{"missing tag", live(func(actual *instance.Instance) { actual.Tags = nil }), []Difference{difference("tag env", "prod", "")}},
+	}
+
+	for _, test := range tests {
+		differences := Instance(expected, test.actual)
+		if !reflect.DeepEqual(differences, test.expected) {
+			t.Errorf("%s: differences %+v, expected %+v", test.name, differences, test.expected)
+		}
+	}
+}
+
+func TestInstanceEmptyFields(t *testing.T) {
+	actual := instance.Instance{ID: "i-1", Name: "mongo-1", Type: "m3.large", ImageID: "ami-1", IAM: "arn:aws:iam::123456789012:instance-profile/mongo"}
+	differences := Instance(instance.Instance{}, actual)
+	if len(differences) != 0 {
+		t.Errorf("empty fields of the file should not be compared, differences %+v", differences)
+	}
+}
+
+func TestVolume(t *testing.T) {
+	expected := volume.Volume{
+		Name: "mongo-data-1",
+		Type: "io1",
+		Size: 100,
+		IOPS: 1000,
+		Tags: []ec2.Tag{{Key: "env", Value: "prod"}},
+	}
+
+	live := func(change func(*volume.Volume)) volume.Volume {
+		actual := expected
+		actual.ID = "vol-1"
+		if change != nil {
+			change(&actual)
+		}
+		return actual
+	}
+
+	difference := func(field, expectedValue, actualValue string) Difference {
+		return Difference{Resource: "volume", Name: "mongo-data-1", ID: "vol-1", Field: field, Expected: expectedValue, Actual: actualValue}
+	}
+
+	tests := []struct {
+		name     string
+		expected volume.Volume
+		actual   volume.Volume
+		result   []Difference
+	}{
+		{"same", expected, live(nil), []Difference{}},
+		{"missing", expected, volume.Volume{}, []Difference{{Resource: "volume", Name: "mongo-data-1", Field: "exists", Expected: "true", Actual: "false"}}},
+		{"type", expected, live(func(actual *volume.Volume) { actual.Type = "gp2" }), []Difference{difference("type", "io1", "gp2")}},
+		{"size", expected, live(func(actual *volume.Volume) { actual.Size = 50 }), []Difference{difference("size", "100", "50")}},
+		{"iops", expected, live(func(actual *volume.Volume) { actual.IOPS = 500 }), []Difference{difference("iops", "1000", "500")}},
+		{"iops of other types", volume.Volume{Name: "mongo-data-1", Type: "gp2", IOPS: 1000}, live(func(actual *volume.Volume) {
+			actual.Type = "gp2"
+			actual.IOPS = 300
+		}), []Difference{}},
+		{"name", expected, live(func(actual *volume.Volume) { actual.Name = "mongo-data-01" }), []Difference{difference("name", "mongo-data-1", "mongo-data-01")}},
+		{"tag", expected, live(func(actual *volume.Volume) { actual.Tags = []ec2.Tag{{Key: "ENV", Value: "dev"}} }), []Difference{difference("tag env", "prod", "dev")}},
+		{"empty fields", volume.Volume{}, live(nil), []Difference{}},
+	}
+
+	for _, test := range tests {
+		differences := Volume(test.expected, test.actual)
+		if !reflect.DeepEqual(differences, test.result) {
+			t.Errorf("%s: differences %+v, expected %+v", test.name, differences, test.result)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Package ec2ext extends the amz.v3 ec2 client with the requests it doesn't
+// have, they are sent as signed queries to the ec2 endpoint of the region
+package ec2ext
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/amz.v3/aws"
+	"gopkg.in/amz.v3/ec2"
+)
+
+// APIVersion is the version of the ec2 api used by the queries
+const APIVersion = "2016-11-15"
+
+const (
+	algorithm   = "AWS4-HMAC-SHA256"
+	service     = "ec2"
+	contentType = "application/x-www-form-urlencoded; charset=utf-8"
+)
+
+// EC2 is the amz.v3 ec2 client plus the requests of this package
+type EC2 struct {
+	*ec2.EC2
+	auth   aws.Auth
+	region aws.Region
+	client *http.Client
+}
+
+// New returns a client of region
+func New(auth aws.Auth, region aws.Region) *EC2 {
+	return &EC2{
+		EC2:    ec2.New(auth, region, aws.SignV4Factory(region.Name, service)),
+		auth:   auth,
+		region: region,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type errorResp struct {
+	RequestID string `xml:"RequestID"`
+	Errors    []struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Errors>Error"`
+}
+
+// query sends action with params and decodes the xml answer into resp, errors
+// answered by aws are returned as *ec2.Error
+func (ec2Ref *EC2) query(action string, params url.Values, resp interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("Action", action)
+	params.Set("Version", APIVersion)
+
+	endpoint, err := url.Parse(ec2Ref.region.EC2Endpoint)
+	if err != nil {
+		return err
+	}
+	if endpoint.Path == "" {
+		endpoint.Path = "/"
+	}
+
+	body := params.Encode()
+	req, err := http.NewRequest("POST", endpoint.String(), strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	sign(req, body, ec2Ref.auth, ec2Ref.region.Name, time.Now().UTC())
+
+	httpResp, err := ec2Ref.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	content, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return buildError(httpResp.StatusCode, content)
+	}
+
+	return xml.Unmarshal(content, resp)
+}
+
+// addList adds values as the list name.1, name.2...
+func addList(params url.Values, name string, values []string) {
+	for i, value := range values {
+		params.Set(name+"."+strconv.Itoa(i+1), value)
+	}
+}
+
+func buildError(statusCode int, content []byte) error {
+	var resp errorResp
+	reqError := &ec2.Error{StatusCode: statusCode}
+
+	err := xml.Unmarshal(content, &resp)
+	if err != nil || len(resp.Errors) == 0 {
+		reqError.Message = http.StatusText(statusCode)
+		return reqError
+	}
+
+	reqError.Code = resp.Errors[0].Code
+	reqError.Message = resp.Errors[0].Message
+	reqError.RequestId = resp.RequestID
+	return reqError
+}
+
+// sign adds the aws signature version 4 headers to the POST request req
+func sign(req *http.Request, body string, auth aws.Auth, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signedHeaders := "content-type;host;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		hashHex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{algorithm, amzDate, scope, hashHex(canonicalRequest)}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(signingKey(auth.SecretKey, date, region, service), stringToSign))
+
+	req.Header.Set("Authorization", algorithm+" Credential="+auth.AccessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// signingKey derives the key of the signature from the secret key
+func signingKey(secretKey, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, content string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(content))
+	return mac.Sum(nil)
+}
+
+func hashHex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,262 @@
+package ec2ext
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/amz.v3/aws"
+	"gopkg.in/amz.v3/ec2"
+)
+
+func TestSigningKey(t *testing.T) {
+	// example of the aws signature version 4 documentation
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20150830", "us-east-1", "iam")
+	expected := "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9"
+	if hex.EncodeToString(key) != expected {
+		t.Errorf("signingKey = %x, expected %s", key, expected)
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := "Action=CopySnapshot&Version=" + APIVersion
+	req, err := http.NewRequest("POST", "https://ec2.us-east-1.amazonaws.com/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	sign(req, body, aws.Auth{AccessKey: "AKIDEXAMPLE", SecretKey: "secret"}, "us-east-1", now)
+
+	if req.Header.Get("X-Amz-Date") != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %q", req.Header.Get("X-Amz-Date"))
+	}
+
+	prefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/ec2/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature="
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, prefix) || len(authorization) != len(prefix)+64 {
+		t.Errorf("Authorization = %q", authorization)
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected ec2.Error
+	}{
+		{
+			content:  `<Response><Errors><Error><Code>InvalidSnapshot.NotFound</Code><Message>The snapshot 'snap-1' does not exist.</Message></Error></Errors><RequestID>req-1</RequestID></Response>`,
+			expected: ec2.Error{StatusCode: 400, Code: "InvalidSnapshot.NotFound", Message: "The snapshot 'snap-1' does not exist.", RequestId: "req-1"},
+		},
+		{
+			content:  "not xml",
+			expected: ec2.Error{StatusCode: 400, Message: "Bad Request"},
+		},
+	}
+
+	for _, test := range tests {
+		err := buildError(400, []byte(test.content))
+		reqError, ok := err.(*ec2.Error)
+		if !ok {
+			t.Fatalf("buildError(%q) = %T, expected *ec2.Error", test.content, err)
+		}
+		if *reqError != test.expected {
+			t.Errorf("buildError(%q) = %+v, expected %+v", test.content, *reqError, test.expected)
+		}
+	}
+}
+
+// testClient returns a client of a server that answers content to the action
+// and checks the params of the request
+func testClient(t *testing.T, action string, params map[string]string, content string) (*EC2, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("Action") != action {
+			t.Errorf("Action = %q, expected %q", r.FormValue("Action"), action)
+		}
+		for key, value := range params {
+			if r.FormValue(key) != value {
+				t.Errorf("%s = %q, expected %q", key, r.FormValue(key), value)
+			}
+		}
+		if r.Header.Get("Authorization") == "" {
+			t.Error("The request isn't signed")
+		}
+
+		fmt.Fprint(w, content)
+	}))
+
+	return New(aws.Auth{AccessKey: "key", SecretKey: "secret"}, aws.Region{Name: "us-east-1", EC2Endpoint: server.URL}), server.Close
+}
+
+func TestDescribeInstanceStatus(t *testing.T) {
+	ec2Ref, done := testClient(t, "DescribeInstanceStatus", map[string]string{"InstanceId.1": "i-1", "IncludeAllInstances": "true"}, `<DescribeInstanceStatusResponse>
+  <requestId>req-1</requestId>
+  <instanceStatusSet>
+    <item>
+      <instanceId>i-1</instanceId>
+      <instanceState><code>16</code><name>running</name></instanceState>
+      <systemStatus><status>ok</status></systemStatus>
+      <instanceStatus><status>initializing</status></instanceStatus>
+    </item>
+  </instanceStatusSet>
+</DescribeInstanceStatusResponse>`)
+	defer done()
+
+	resp, err := ec2Ref.DescribeInstanceStatus("i-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := InstanceStatus{InstanceID: "i-1", State: "running", SystemStatus: "ok", InstanceStatus: "initializing"}
+	if len(resp.InstanceStatus) != 1 || resp.InstanceStatus[0] != expected {
+		t.Errorf("DescribeInstanceStatus = %+v, expected %+v", resp.InstanceStatus, expected)
+	}
+}
+
+func TestGetConsoleOutput(t *testing.T) {
+	ec2Ref, done := testClient(t, "GetConsoleOutput", map[string]string{"InstanceId": "i-1"}, `<GetConsoleOutputResponse>
+  <requestId>req-1</requestId>
+  <instanceId>i-1</instanceId>
+  <timestamp>2010-10-14T01:12:41.000Z</timestamp>
+  <output>Ym9vdGluZwo=</output>
+</GetConsoleOutputResponse>`)
+	defer done()
+
+	resp, err := ec2Ref.GetConsoleOutput("i-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.InstanceID != "i-1" || resp.Output != "Ym9vdGluZwo=" {
+		t.Errorf("GetConsoleOutput = %+v", *resp)
+	}
+}
+
+func TestLaunchTimes(t *testing.T) {
+	ec2Ref, done := testClient(t, "DescribeInstances", map[string]string{"InstanceId.1": "i-1", "InstanceId.2": "i-2"}, `<DescribeInstancesResponse>
+  <requestId>req-1</requestId>
+  <reservationSet>
+    <item>
+      <reservationId>r-1</reservationId>
+      <instancesSet>
+        <item><instanceId>i-1</instanceId><launchTime>2017-03-01T10:20:30.000Z</launchTime></item>
+        <item><instanceId>i-2</instanceId><launchTime>2017-03-02T10:20:30.000Z</launchTime></item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+</DescribeInstancesResponse>`)
+	defer done()
+
+	launchTimes, err := ec2Ref.LaunchTimes("i-1", "i-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]time.Time{
+		"i-1": time.Date(2017, 3, 1, 10, 20, 30, 0, time.UTC),
+		"i-2": time.Date(2017, 3, 2, 10, 20, 30, 0, time.UTC),
+	}
+	for id, launchTime := range expected {
+		if !launchTimes[id].Equal(launchTime) {
+			t.Errorf("LaunchTimes()[%s] = %s, expected %s", id, launchTimes[id], launchTime)
+		}
+	}
+}
+
+func TestDisableAPITermination(t *testing.T) {
+	ec2Ref, done := testClient(t, "DescribeInstanceAttribute", map[string]string{"InstanceId": "i-1", "Attribute": "disableApiTermination"}, `<DescribeInstanceAttributeResponse>
+  <requestId>req-1</requestId>
+  <instanceId>i-1</instanceId>
+  <disableApiTermination><value>true</value></disableApiTermination>
+</DescribeInstanceAttributeResponse>`)
+	defer done()
+
+	protected, err := ec2Ref.DisableAPITermination("i-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !protected {
+		t.Error("DisableAPITermination = false, expected true")
+	}
+}
+
+func TestInstanceProfiles(t *testing.T) {
+	ec2Ref, done := testClient(t, "DescribeInstances", map[string]string{"InstanceId.1": "i-1", "InstanceId.2": "i-2"}, `<DescribeInstancesResponse>
+  <requestId>req-1</requestId>
+  <reservationSet>
+    <item>
+      <reservationId>r-1</reservationId>
+      <instancesSet>
+        <item>
+          <instanceId>i-1</instanceId>
+          <iamInstanceProfile><arn>arn:aws:iam::123456789012:instance-profile/mongo</arn><id>AIPAEXAMPLE</id></iamInstanceProfile>
+        </item>
+        <item><instanceId>i-2</instanceId></item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+</DescribeInstancesResponse>`)
+	defer done()
+
+	profiles, err := ec2Ref.InstanceProfiles("i-1", "i-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"i-1": "arn:aws:iam::123456789012:instance-profile/mongo", "i-2": ""}
+	for id, arn := range expected {
+		if profiles[id] != arn {
+			t.Errorf("InstanceProfiles()[%s] = %q, expected %q", id, profiles[id], arn)
+		}
+	}
+}
+
+func TestOwnSnapshots(t *testing.T) {
+	params := map[string]string{"Owner.1": "self", "SnapshotId.1": "snap-1", "Filter.1.Name": "tag:cloud-machine:cluster", "Filter.1.Value.1": "mongo"}
+	ec2Ref, done := testClient(t, "DescribeSnapshots", params, `<DescribeSnapshotsResponse>
+  <requestId>req-1</requestId>
+  <snapshotSet>
+    <item>
+      <snapshotId>snap-1</snapshotId>
+      <volumeId>vol-1</volumeId>
+      <status>completed</status>
+      <startTime>2017-03-01T10:20:30.000Z</startTime>
+      <progress>100%</progress>
+      <ownerId>123456789012</ownerId>
+      <volumeSize>100</volumeSize>
+      <description>data of mongo-1</description>
+      <tagSet>
+        <item><key>cloud-machine:cluster</key><value>mongo</value></item>
+      </tagSet>
+    </item>
+  </snapshotSet>
+</DescribeSnapshotsResponse>`)
+	defer done()
+
+	snapshots, err := ec2Ref.OwnSnapshots([]string{"snap-1"}, []ec2.Tag{{Key: "cloud-machine:cluster", Value: "mongo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ec2.Snapshot{
+		Id:          "snap-1",
+		VolumeId:    "vol-1",
+		VolumeSize:  "100",
+		Status:      "completed",
+		StartTime:   "2017-03-01T10:20:30.000Z",
+		Description: "data of mongo-1",
+		Progress:    "100%",
+		OwnerId:     "123456789012",
+		Tags:        []ec2.Tag{{Key: "cloud-machine:cluster", Value: "mongo"}},
+	}
+	if len(snapshots) != 1 || !reflect.DeepEqual(snapshots[0], expected) {
+		t.Errorf("OwnSnapshots = %+v, expected %+v", snapshots, expected)
+	}
+}
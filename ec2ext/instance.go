@@ -0,0 +1,173 @@
+package ec2ext
+
+import (
+	"net/url"
+	"time"
+)
+
+// Attributes of an instance that ModifyInstanceAttribute changes
+const (
+	InstanceTypeAttribute          = "InstanceType"
+	EBSOptimizedAttribute          = "EbsOptimized"
+	DisableAPITerminationAttribute = "DisableApiTermination"
+)
+
+// SimpleResp is the answer of the requests that only return if they worked
+type SimpleResp struct {
+	RequestID string `xml:"requestId"`
+	Return    bool   `xml:"return"`
+}
+
+// ModifyInstanceAttribute changes one attribute of the instance, aws accepts
+// only one attribute per request. InstanceType and EbsOptimized can be changed
+// only when the instance is stopped.
+func (ec2Ref *EC2) ModifyInstanceAttribute(instanceID, attribute, value string) (*SimpleResp, error) {
+	params := url.Values{}
+	params.Set("InstanceId", instanceID)
+	params.Set(attribute+".Value", value)
+
+	resp := &SimpleResp{}
+	err := ec2Ref.query("ModifyInstanceAttribute", params, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// InstanceStatus is the state and the status checks of an instance, the
+// checks are ok, impaired, initializing, insufficient-data or not-applicable
+type InstanceStatus struct {
+	InstanceID     string `xml:"instanceId"`
+	State          string `xml:"instanceState>name"`
+	SystemStatus   string `xml:"systemStatus>status"`
+	InstanceStatus string `xml:"instanceStatus>status"`
+}
+
+// DescribeInstanceStatusResp is the answer of DescribeInstanceStatus
+type DescribeInstanceStatusResp struct {
+	RequestID      string           `xml:"requestId"`
+	InstanceStatus []InstanceStatus `xml:"instanceStatusSet>item"`
+}
+
+// DescribeInstanceStatus returns the status checks of the instances, stopped
+// instances are returned too
+func (ec2Ref *EC2) DescribeInstanceStatus(instanceIDs ...string) (*DescribeInstanceStatusResp, error) {
+	params := url.Values{}
+	params.Set("IncludeAllInstances", "true")
+	addList(params, "InstanceId", instanceIDs)
+
+	resp := &DescribeInstanceStatusResp{}
+	err := ec2Ref.query("DescribeInstanceStatus", params, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// GetConsoleOutputResp is the answer of GetConsoleOutput, the output is
+// base64 encoded
+type GetConsoleOutputResp struct {
+	RequestID  string `xml:"requestId"`
+	InstanceID string `xml:"instanceId"`
+	Timestamp  string `xml:"timestamp"`
+	Output     string `xml:"output"`
+}
+
+// GetConsoleOutput returns the console output of the instance
+func (ec2Ref *EC2) GetConsoleOutput(instanceID string) (*GetConsoleOutputResp, error) {
+	params := url.Values{}
+	params.Set("InstanceId", instanceID)
+
+	resp := &GetConsoleOutputResp{}
+	err := ec2Ref.query("GetConsoleOutput", params, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// DisableAPITerminationResp is the answer of DescribeInstanceAttribute for
+// the disableApiTermination attribute
+type DisableAPITerminationResp struct {
+	RequestID  string `xml:"requestId"`
+	InstanceID string `xml:"instanceId"`
+	Value      bool   `xml:"disableApiTermination>value"`
+}
+
+// DisableAPITermination returns true when the termination protection of the
+// instance is on, so it can't be terminated by the api
+func (ec2Ref *EC2) DisableAPITermination(instanceID string) (bool, error) {
+	params := url.Values{}
+	params.Set("InstanceId", instanceID)
+	params.Set("Attribute", "disableApiTermination")
+
+	resp := &DisableAPITerminationResp{}
+	err := ec2Ref.query("DescribeInstanceAttribute", params, resp)
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Value, nil
+}
+
+// LaunchTimesResp is the launch time of each instance answered by
+// DescribeInstances, the amz.v3 client doesn't parse it
+type LaunchTimesResp struct {
+	RequestID string `xml:"requestId"`
+	Instances []struct {
+		InstanceID string    `xml:"instanceId"`
+		LaunchTime time.Time `xml:"launchTime"`
+	} `xml:"reservationSet>item>instancesSet>item"`
+}
+
+// InstanceProfilesResp is the instance profile of each instance answered by
+// DescribeInstances, the amz.v3 client parses only its id
+type InstanceProfilesResp struct {
+	RequestID string `xml:"requestId"`
+	Instances []struct {
+		InstanceID string `xml:"instanceId"`
+		ARN        string `xml:"iamInstanceProfile>arn"`
+	} `xml:"reservationSet>item>instancesSet>item"`
+}
+
+// InstanceProfiles returns the arn of the instance profile of each instance,
+// by instance Id, instances without a profile have an empty arn
+func (ec2Ref *EC2) InstanceProfiles(instanceIDs ...string) (map[string]string, error) {
+	params := url.Values{}
+	addList(params, "InstanceId", instanceIDs)
+
+	resp := &InstanceProfilesResp{}
+	err := ec2Ref.query("DescribeInstances", params, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]string, len(resp.Instances))
+	for _, instance := range resp.Instances {
+		profiles[instance.InstanceID] = instance.ARN
+	}
+
+	return profiles, nil
+}
+
+// LaunchTimes returns when each instance was launched, by instance Id
+func (ec2Ref *EC2) LaunchTimes(instanceIDs ...string) (map[string]time.Time, error) {
+	params := url.Values{}
+	addList(params, "InstanceId", instanceIDs)
+
+	resp := &LaunchTimesResp{}
+	err := ec2Ref.query("DescribeInstances", params, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	launchTimes := make(map[string]time.Time, len(resp.Instances))
+	for _, instance := range resp.Instances {
+		launchTimes[instance.InstanceID] = instance.LaunchTime
+	}
+
+	return launchTimes, nil
+}
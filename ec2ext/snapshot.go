@@ -0,0 +1,93 @@
+package ec2ext
+
+import (
+	"net/url"
+	"strconv"
+
+	"gopkg.in/amz.v3/ec2"
+)
+
+// CopySnapshotResp is the answer of CopySnapshot
+type CopySnapshotResp struct {
+	RequestID  string `xml:"requestId"`
+	SnapshotID string `xml:"snapshotId"`
+}
+
+// CopySnapshot copies the snapshot sourceSnapshotID of sourceRegion to the
+// region of the client, the copy starts as pending
+func (ec2Ref *EC2) CopySnapshot(sourceRegion, sourceSnapshotID, description string) (*CopySnapshotResp, error) {
+	params := url.Values{}
+	params.Set("SourceRegion", sourceRegion)
+	params.Set("SourceSnapshotId", sourceSnapshotID)
+	if description != "" {
+		params.Set("Description", description)
+	}
+
+	resp := &CopySnapshotResp{}
+	err := ec2Ref.query("CopySnapshot", params, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// OwnSnapshotsResp is the answer of DescribeSnapshots
+type OwnSnapshotsResp struct {
+	RequestID string `xml:"requestId"`
+	Snapshots []struct {
+		ID          string `xml:"snapshotId"`
+		VolumeID    string `xml:"volumeId"`
+		VolumeSize  string `xml:"volumeSize"`
+		Status      string `xml:"status"`
+		StartTime   string `xml:"startTime"`
+		Description string `xml:"description"`
+		Progress    string `xml:"progress"`
+		OwnerID     string `xml:"ownerId"`
+		Tags        []struct {
+			Key   string `xml:"key"`
+			Value string `xml:"value"`
+		} `xml:"tagSet>item"`
+	} `xml:"snapshotSet>item"`
+}
+
+// OwnSnapshots returns the snapshots of the account that have all filterTags,
+// only the snapshots ids when they are passed. The amz.v3 client can't limit
+// the owner, so it returns the public and shared snapshots of other accounts
+// too.
+func (ec2Ref *EC2) OwnSnapshots(ids []string, filterTags []ec2.Tag) ([]ec2.Snapshot, error) {
+	params := url.Values{}
+	params.Set("Owner.1", "self")
+	addList(params, "SnapshotId", ids)
+	for i, tag := range filterTags {
+		filter := "Filter." + strconv.Itoa(i+1)
+		params.Set(filter+".Name", "tag:"+tag.Key)
+		params.Set(filter+".Value.1", tag.Value)
+	}
+
+	resp := &OwnSnapshotsResp{}
+	err := ec2Ref.query("DescribeSnapshots", params, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]ec2.Snapshot, len(resp.Snapshots))
+	for key, item := range resp.Snapshots {
+		snapshots[key] = ec2.Snapshot{
+			Id:          item.ID,
+			VolumeId:    item.VolumeID,
+			VolumeSize:  item.VolumeSize,
+			Status:      item.Status,
+			StartTime:   item.StartTime,
+			Description: item.Description,
+			Progress:    item.Progress,
+			OwnerId:     item.OwnerID,
+		}
+
+		for _, tag := range item.Tags {
+			snapshots[key].Tags = append(snapshots[key].Tags, ec2.Tag{Key: tag.Key, Value: tag.Value})
+		}
+	}
+
+	return snapshots, nil
+}
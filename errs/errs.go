@@ -0,0 +1,121 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/amz.v3/ec2"
+)
+
+type (
+	// NotFoundError is returned when a instance, volume or snapshot doesn't
+	// exist
+	NotFoundError struct {
+		Resource string
+		ID       string
+		Err      error
+	}
+
+	// AlreadyAttachedError is returned when a volume is already attached to
+	// another instance or device
+	AlreadyAttachedError struct {
+		VolumeID   string
+		InstanceID string
+		Device     string
+		Err        error
+	}
+
+	// CapacityError is returned when aws doesn't have capacity to create the
+	// resource, it could work in another available zone or instance type
+	CapacityError struct {
+		Err error
+	}
+
+	// ThrottledError is returned when aws is limiting the requests, it should
+	// work after waiting a while
+	ThrottledError struct {
+		Err error
+	}
+
+	// ConfigError is returned when the machine or cluster files are invalid,
+	// it never works until the files are fixed
+	ConfigError struct {
+		Message string
+		Err     error
+	}
+)
+
+func (err *NotFoundError) Error() string {
+	if err.Err != nil {
+		return err.Err.Error()
+	}
+
+	return fmt.Sprintf("Any %s was found with Id <%s>", err.Resource, err.ID)
+}
+
+func (err *NotFoundError) Unwrap() error {
+	return err.Err
+}
+
+func (err *AlreadyAttachedError) Error() string {
+	if err.Err != nil {
+		return err.Err.Error()
+	}
+
+	return fmt.Sprintf("The volume <%s> is attached to instance <%s> on device <%s>", err.VolumeID, err.InstanceID, err.Device)
+}
+
+func (err *AlreadyAttachedError) Unwrap() error {
+	return err.Err
+}
+
+func (err *CapacityError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *CapacityError) Unwrap() error {
+	return err.Err
+}
+
+func (err *ThrottledError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *ThrottledError) Unwrap() error {
+	return err.Err
+}
+
+func (err *ConfigError) Error() string {
+	if err.Err != nil {
+		return fmt.Sprintf("%s: %s", err.Message, err.Err.Error())
+	}
+
+	return err.Message
+}
+
+func (err *ConfigError) Unwrap() error {
+	return err.Err
+}
+
+// Wrap returns the typed error of a ec2 error, errors that are not known are
+// returned as they are
+func Wrap(err error) error {
+	var reqError *ec2.Error
+	if err == nil || !errors.As(err, &reqError) {
+		return err
+	}
+
+	switch {
+	case strings.HasSuffix(reqError.Code, ".NotFound"):
+		return &NotFoundError{Err: err}
+	case reqError.Code == "VolumeInUse":
+		return &AlreadyAttachedError{Err: err}
+	case strings.HasPrefix(reqError.Code, "Insufficient"):
+		return &CapacityError{Err: err}
+	case reqError.Code == "RequestLimitExceeded" || reqError.Code == "Throttling":
+		return &ThrottledError{Err: err}
+	}
+
+	return err
+}
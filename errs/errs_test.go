@@ -0,0 +1,45 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gopkg.in/amz.v3/ec2"
+)
+
+func TestWrap(t *testing.T) {
+	plain := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		err      error
+		expected reflect.Type
+	}{
+		{"instance not found", &ec2.Error{Code: "InvalidInstanceID.NotFound"}, reflect.TypeOf(&NotFoundError{})},
+		{"volume not found", &ec2.Error{Code: "InvalidVolume.NotFound"}, reflect.TypeOf(&NotFoundError{})},
+		{"volume in use", &ec2.Error{Code: "VolumeInUse"}, reflect.TypeOf(&AlreadyAttachedError{})},
+		{"capacity", &ec2.Error{Code: "InsufficientInstanceCapacity"}, reflect.TypeOf(&CapacityError{})},
+		{"request limit", &ec2.Error{Code: "RequestLimitExceeded"}, reflect.TypeOf(&ThrottledError{})},
+		{"throttling", &ec2.Error{Code: "Throttling"}, reflect.TypeOf(&ThrottledError{})},
+		{"wrapped ec2 error", fmt.Errorf("loading: %w", &ec2.Error{Code: "Throttling"}), reflect.TypeOf(&ThrottledError{})},
+		{"unknown code", &ec2.Error{Code: "UnauthorizedOperation"}, reflect.TypeOf(&ec2.Error{})},
+		{"not an ec2 error", plain, reflect.TypeOf(plain)},
+	}
+
+	for _, test := range tests {
+		wrapped := Wrap(test.err)
+		if reflect.TypeOf(wrapped) != test.expected {
+			t.Errorf("%s: wrapped as %T, expected %s", test.name, wrapped, test.expected)
+		}
+
+		if !errors.Is(wrapped, test.err) {
+			t.Errorf("%s: wrapped error doesn't unwrap to the original", test.name)
+		}
+	}
+
+	if Wrap(nil) != nil {
+		t.Errorf("nil should be returned as nil")
+	}
+}
@@ -0,0 +1,55 @@
+package instance
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/NeowayLabs/cloud-machine/ec2ext"
+	"github.com/NeowayLabs/cloud-machine/retry"
+)
+
+// ConsoleTailLines is how many lines of the console output are shown when an
+// instance fails
+const ConsoleTailLines = 30
+
+// ConsoleOutput returns the console output of the instance, aws keeps only
+// the last 64 KB of it and updates it a few minutes after the instance boots
+func ConsoleOutput(ec2Ref *ec2ext.EC2, instance Instance) (string, error) {
+	var resp *ec2ext.GetConsoleOutputResp
+	err := retry.Do("GetConsoleOutput", func() (err error) {
+		resp, err = ec2Ref.GetConsoleOutput(instance.ID)
+		return
+	})
+	if err != nil {
+		return "", err
+	}
+
+	output, err := base64.StdEncoding.DecodeString(resp.Output)
+	if err != nil {
+		return "", err
+	}
+
+	return string(output), nil
+}
+
+// Tail returns the last lines of the output
+func Tail(output string, lines int) string {
+	all := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if lines > 0 && len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+
+	return strings.Join(all, "\n")
+}
+
+// WithConsoleOutput adds the tail of the console output of the instance to
+// the error, so the reason of the failure can be seen
+func WithConsoleOutput(ec2Ref *ec2ext.EC2, instance Instance, err error) error {
+	output, consoleErr := ConsoleOutput(ec2Ref, instance)
+	if consoleErr != nil || output == "" {
+		return err
+	}
+
+	return fmt.Errorf("%w\nLast lines of the console output of instance <%s>:\n%s", err, instance.ID, Tail(output, ConsoleTailLines))
+}
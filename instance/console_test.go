@@ -0,0 +1,26 @@
+package instance
+
+import "testing"
+
+func TestTail(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		lines    int
+		expected string
+	}{
+		{"empty", "", 2, ""},
+		{"all lines", "a\nb\nc\n", 0, "a\nb\nc"},
+		{"last lines", "a\nb\nc\n", 2, "b\nc"},
+		{"fewer lines", "a\nb\n", 5, "a\nb"},
+		{"same lines", "a\nb", 2, "a\nb"},
+		{"trailing newlines", "a\nb\nc\n\n\n", 1, "c"},
+	}
+
+	for _, test := range tests {
+		tail := Tail(test.output, test.lines)
+		if tail != test.expected {
+			t.Errorf("%s: tail is %q, expected %q", test.name, tail, test.expected)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package instance
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NeowayLabs/cloud-machine/ec2ext"
+	"github.com/NeowayLabs/cloud-machine/errs"
+	"github.com/NeowayLabs/cloud-machine/retry"
+)
+
+// DefaultHealthTimeout is how long an instance has to become healthy, in seconds
+const DefaultHealthTimeout = 600
+
+// HealthCheck tells when an instance is healthy, the aws status checks of the
+// instance must be ok and, when Port is informed, the port of the private IP
+// must accept connections or, when Path is informed too, answer http requests
+// with success
+type HealthCheck struct {
+	Port    int
+	Path    string
+	Timeout int // in seconds
+}
+
+// Status returns the system and instance status checks of the instance, they
+// are ok, impaired, initializing, insufficient-data or not-applicable
+func Status(ec2Ref *ec2ext.EC2, instance Instance) (system string, status string, err error) {
+	var resp *ec2ext.DescribeInstanceStatusResp
+	err = retry.Do("DescribeInstanceStatus", func() (err error) {
+		resp, err = ec2Ref.DescribeInstanceStatus(instance.ID)
+		return
+	})
+	if err != nil {
+		return "", "", err
+	} else if len(resp.InstanceStatus) == 0 {
+		return "", "", &errs.NotFoundError{Resource: "instance", ID: instance.ID}
+	}
+
+	return resp.InstanceStatus[0].SystemStatus, resp.InstanceStatus[0].InstanceStatus, nil
+}
+
+// WaitUntilHealthy waits until the instance passes the health check or the
+// timeout of the check is reached
+func WaitUntilHealthy(ec2Ref *ec2ext.EC2, instance Instance, check HealthCheck) error {
+	timeout := time.Duration(check.Timeout) * time.Second
+	if check.Timeout <= 0 {
+		timeout = DefaultHealthTimeout * time.Second
+	}
+
+	fmt.Fprintf(loggerOutput, "Waiting instance <%s> be healthy", instance.ID)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		fmt.Fprint(loggerOutput, ".")
+		err := probe(ec2Ref, instance, check)
+		if err == nil {
+			fmt.Fprintln(loggerOutput, " [OK]")
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			fmt.Fprintln(loggerOutput, " [ERROR]")
+			return fmt.Errorf("Instance <%s> isn't healthy after %s: %s", instance.ID, timeout, err.Error())
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func probe(ec2Ref *ec2ext.EC2, instance Instance, check HealthCheck) error {
+	system, status, err := Status(ec2Ref, instance)
+	if err != nil {
+		return err
+	} else if system != "ok" || status != "ok" {
+		return fmt.Errorf("system status is <%s> and instance status is <%s>", system, status)
+	}
+
+	if check.Port == 0 {
+		return nil
+	}
+
+	address := net.JoinHostPort(instance.PrivateIPAddress, strconv.Itoa(check.Port))
+	if check.Path == "" {
+		conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	}
+
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + address + check.Path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("http://%s%s answered <%s>", address, check.Path, resp.Status)
+	}
+
+	return nil
+}
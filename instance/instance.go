@@ -1,14 +1,24 @@
 package instance
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/NeowayLabs/cloud-machine/ec2ext"
+	"github.com/NeowayLabs/cloud-machine/errs"
+	"github.com/NeowayLabs/cloud-machine/retry"
+	"github.com/NeowayLabs/cloud-machine/tags"
+	"github.com/NeowayLabs/cloud-machine/volume"
 	"gopkg.in/amz.v3/ec2"
 )
 
@@ -21,6 +31,34 @@ func SetLogger(out io.Writer, prefix string, flag int) {
 	logger = log.New(out, prefix, flag)
 }
 
+// Placement is an available zone and a subnet of this available zone
+type Placement struct {
+	AvailableZone string
+	SubnetID      string
+}
+
+// UserData has the values available to the cloud-config template
+type UserData struct {
+	NodeIndex     int
+	NodeName      string
+	ClusterName   string
+	Region        string
+	AvailableZone string
+	Volumes       []volume.Volume
+	Tags          map[string]string
+	Clusters      map[string][]ClusterNode // nodes of the clusters created before, by cluster name
+}
+
+// ClusterNode is a node of a cluster that was already created
+type ClusterNode struct {
+	Index         int
+	Name          string
+	ID            string
+	PrivateIP     string
+	PublicIP      string
+	AvailableZone string
+}
+
 // Instance ...
 type Instance struct {
 	ID                   string
@@ -31,18 +69,33 @@ type Instance struct {
 	KeyName              string
 	SecurityGroups       []string
 	SubnetID             string
+	PrivateIP            string
 	DefaultAvailableZone string // backward compatibility, use availablezone instead
 	AvailableZone        string
 	CloudConfig          string
+	CloudConfigTemplate  bool // the cloud-config is a text/template rendered with UserData
 	EBSOptimized         bool
 	ShutdownBehavior     string
 	EnableAPITermination bool
 	PlacementGroupName   string
 	IAM                  string
-	Tags                 []ec2.Tag // ec2.Instance already have this property but yml would need new section
+	FallbackTypes        []string    // types tried when aws doesn't have capacity of Type
+	FallbackPlacements   []Placement // placements tried when aws doesn't have capacity in AvailableZone
+	Readiness            HealthCheck // checked after the instance is rebooted
+	Reboot               string      // when the instance is rebooted after attaching the volumes
+	Tags                 []ec2.Tag   // ec2.Instance already have this property but yml would need new section
+	UserData             UserData    `yaml:"-"` // values passed by machine and cluster to the cloud-config template
 	ec2.Instance
 }
 
+// Valid values to Reboot, the volumes are mounted by the cloud-config only when
+// the instance boots
+const (
+	RebootNever      = "never"
+	RebootAlways     = "always"
+	RebootIfAttached = "ifattached" // only new instances with volumes attached now
+)
+
 func mergeInstances(instance *Instance, ec2Instance *ec2.Instance) {
 	instance.Instance = *ec2Instance
 	// Instance struct has some fields that is present in ec2.Instance
@@ -51,6 +104,7 @@ func mergeInstances(instance *Instance, ec2Instance *ec2.Instance) {
 	instance.Type = ec2Instance.InstanceType
 	instance.ImageID = ec2Instance.ImageId
 	instance.SubnetID = ec2Instance.SubnetId
+	instance.PrivateIP = ec2Instance.PrivateIPAddress
 	instance.KeyName = ec2Instance.KeyName
 	instance.AvailableZone = ec2Instance.AvailZone
 	instance.EBSOptimized = ec2Instance.EBSOptimized
@@ -72,10 +126,22 @@ func mergeInstances(instance *Instance, ec2Instance *ec2.Instance) {
 }
 
 // WaitUntilState valid values to state is: pending, running, shutting-down, terminated, stopping, stopped
-func WaitUntilState(ec2Ref *ec2.EC2, instance *Instance, state string) error {
+func WaitUntilState(ec2Ref *ec2ext.EC2, instance *Instance, state string) error {
+	return WaitUntilStateTimeout(ec2Ref, instance, state, 0)
+}
+
+// WaitUntilStateTimeout is like WaitUntilState, but it gives up after the
+// timeout, a timeout 0 waits forever
+func WaitUntilStateTimeout(ec2Ref *ec2ext.EC2, instance *Instance, state string, timeout time.Duration) error {
 	fmt.Fprintf(loggerOutput, "Instance state is <%s>, waiting for <%s>", instance.State.Name, state)
+	deadline := time.Now().Add(timeout)
 	for {
 		fmt.Fprint(loggerOutput, ".")
+		if timeout > 0 && instance.State.Name != state && time.Now().After(deadline) {
+			fmt.Fprintln(loggerOutput, " [ERROR]")
+			return fmt.Errorf("Instance <%s> is <%s> after %s, it should be <%s>", instance.ID, instance.State.Name, timeout, state)
+		}
+
 		if instance.State.Name != state {
 			time.Sleep(2 * time.Second)
 			_, err := Load(ec2Ref, instance)
@@ -91,7 +157,7 @@ func WaitUntilState(ec2Ref *ec2.EC2, instance *Instance, state string) error {
 }
 
 // Get a instance, if Id was not passed a new instance will be created
-func Get(ec2Ref *ec2.EC2, instance *Instance) (ec2Instance ec2.Instance, err error) {
+func Get(ec2Ref *ec2ext.EC2, instance *Instance) (ec2Instance ec2.Instance, err error) {
 	if instance.ID == "" {
 		logger.Printf("Creating new instance...\n")
 		ec2Instance, err = Create(ec2Ref, instance)
@@ -115,30 +181,37 @@ func Get(ec2Ref *ec2.EC2, instance *Instance) (ec2Instance ec2.Instance, err err
 	logger.Printf("    Security Groups: %+v\n", instance.SecurityGroups)
 	logger.Printf("    PlacementGroupName: %+v\n", instance.PlacementGroupName)
 	logger.Printf("    Subnet Id: %s\n", instance.SubnetID)
-	logger.Printf("    EBS Optimized: %s\n", instance.EBSOptimized)
-	logger.Printf("    IAM: %s\n", instance.IAM)	
+	if instance.PrivateIP != "" {
+		logger.Printf("    Private IP: %s\n", instance.PrivateIP)
+	}
+	logger.Printf("    EBS Optimized: %t\n", instance.EBSOptimized)
+	logger.Printf("    IAM: %s\n", instance.IAM)
 	if len(instance.Tags) > 0 {
 		logger.Printf("    Tags:\n")
 		for _, tag := range instance.Tags {
 			logger.Printf("        %s: %s\n", tag.Key, tag.Value)
 		}
 	}
-	logger.Println("----------------------------------\n")
+	logger.Printf("----------------------------------\n\n")
 
 	return
 }
 
 // Load a instance passing its Id
-func Load(ec2Ref *ec2.EC2, instance *Instance) (ec2.Instance, error) {
+func Load(ec2Ref *ec2ext.EC2, instance *Instance) (ec2.Instance, error) {
 	if instance.ID == "" {
 		return ec2.Instance{}, errors.New("To load a instance you need to pass its Id")
 	}
 
-	resp, err := ec2Ref.Instances([]string{instance.ID}, nil)
+	var resp *ec2.InstancesResp
+	err := retry.Do("DescribeInstances", func() (err error) {
+		resp, err = ec2Ref.Instances([]string{instance.ID}, nil)
+		return
+	})
 	if err != nil {
 		return ec2.Instance{}, err
 	} else if len(resp.Reservations) == 0 || len(resp.Reservations[0].Instances) == 0 {
-		return ec2.Instance{}, fmt.Errorf("Any instance was found with instance Id <%s>", instance.ID)
+		return ec2.Instance{}, &errs.NotFoundError{Resource: "instance", ID: instance.ID}
 	}
 
 	ec2Instance := resp.Reservations[0].Instances[0]
@@ -147,8 +220,42 @@ func Load(ec2Ref *ec2.EC2, instance *Instance) (ec2.Instance, error) {
 	return ec2Instance, nil
 }
 
-// Create new instance
-func Create(ec2Ref *ec2.EC2, instance *Instance) (ec2.Instance, error) {
+// Create new instance, when aws doesn't have capacity to create it, the
+// fallback types are tried in the same placement and after that all types are
+// tried in each fallback placement
+func Create(ec2Ref *ec2ext.EC2, instance *Instance) (ec2.Instance, error) {
+	placements := append([]Placement{{AvailableZone: instance.AvailableZone, SubnetID: instance.SubnetID}}, instance.FallbackPlacements...)
+	types := append([]string{instance.Type}, instance.FallbackTypes...)
+
+	var err error
+	for _, placement := range placements {
+		for _, instanceType := range types {
+			candidate := *instance
+			candidate.Type = instanceType
+			candidate.AvailableZone = placement.AvailableZone
+			candidate.SubnetID = placement.SubnetID
+			if instanceType != instance.Type {
+				candidate.Tags = tags.Set(candidate.Tags, tags.RequestedType, instance.Type)
+			}
+
+			var ec2Instance ec2.Instance
+			ec2Instance, err = create(ec2Ref, &candidate)
+
+			var capacityError *errs.CapacityError
+			if errors.As(err, &capacityError) {
+				logger.Printf("No capacity of <%s> in <%s>: %s\n", instanceType, placement.AvailableZone, err.Error())
+				continue
+			}
+
+			*instance = candidate
+			return ec2Instance, err
+		}
+	}
+
+	return ec2.Instance{}, err
+}
+
+func create(ec2Ref *ec2ext.EC2, instance *Instance) (ec2.Instance, error) {
 	options := ec2.RunInstances{
 		ImageId:               instance.ImageID,
 		InstanceType:          instance.Type,
@@ -162,9 +269,9 @@ func Create(ec2Ref *ec2.EC2, instance *Instance) (ec2.Instance, error) {
 	}
 
 	if instance.CloudConfig != "" {
-		userdata, err := ioutil.ReadFile(instance.CloudConfig)
+		userdata, err := RenderCloudConfig(*instance)
 		if err != nil {
-			panic(err.Error())
+			return ec2.Instance{}, err
 		}
 
 		options.UserData = userdata
@@ -178,11 +285,19 @@ func Create(ec2Ref *ec2.EC2, instance *Instance) (ec2.Instance, error) {
 		options.PlacementGroupName = instance.PlacementGroupName
 	}
 
+	if instance.PrivateIP != "" {
+		options.PrivateIPAddress = instance.PrivateIP
+	}
+
 	for i, securityGroup := range instance.SecurityGroups {
 		options.SecurityGroups[i] = ec2.SecurityGroup{Id: securityGroup}
 	}
 
-	resp, err := ec2Ref.RunInstances(&options)
+	var resp *ec2.RunInstancesResp
+	err := retry.DoThrottled("RunInstances", func() (err error) {
+		resp, err = ec2Ref.RunInstances(&options)
+		return
+	})
 	if err != nil {
 		return ec2.Instance{}, err
 	} else if len(resp.Instances) == 0 {
@@ -190,8 +305,10 @@ func Create(ec2Ref *ec2.EC2, instance *Instance) (ec2.Instance, error) {
 	}
 
 	ec2Instance := resp.Instances[0]
-	tags := append(instance.Tags, ec2.Tag{"Name", instance.Name})
-	_, err = ec2Ref.CreateTags([]string{ec2Instance.InstanceId}, tags)
+	err = retry.Do("CreateTags", func() error {
+		_, err := ec2Ref.CreateTags([]string{ec2Instance.InstanceId}, tags.Set(instance.Tags, "Name", instance.Name))
+		return err
+	})
 	if err != nil {
 		return ec2.Instance{}, err
 	}
@@ -206,10 +323,279 @@ func Create(ec2Ref *ec2.EC2, instance *Instance) (ec2.Instance, error) {
 	return ec2Instance, nil
 }
 
+// ParseCloudConfig reads the cloud-config file as a text/template
+func ParseCloudConfig(file string) (*template.Template, error) {
+	cloudConfig, err := template.New(filepath.Base(file)).ParseFiles(file)
+	if err != nil {
+		return nil, &errs.ConfigError{Message: "Error reading cloud-config", Err: err}
+	}
+
+	return cloudConfig, nil
+}
+
+// TemplateData returns the values passed to the cloud-config template, the
+// node name, cluster name, node index and tags already in UserData are kept,
+// the missing ones come from the name and tags of the instance
+func TemplateData(instance Instance) UserData {
+	data := instance.UserData
+	data.Region = instance.Region
+	data.AvailableZone = instance.AvailableZone
+
+	if data.NodeName == "" {
+		data.NodeName = instance.Name
+	}
+	if data.ClusterName == "" {
+		data.ClusterName = tags.Get(instance.Tags, tags.Cluster)
+	}
+	if data.NodeIndex == 0 {
+		data.NodeIndex, _ = strconv.Atoi(tags.Get(instance.Tags, tags.Node))
+	}
+
+	if data.Tags == nil {
+		data.Tags = make(map[string]string)
+		for _, tag := range instance.Tags {
+			data.Tags[tag.Key] = tag.Value
+		}
+	}
+
+	return data
+}
+
+// RenderCloudConfig executes the cloud-config template of the instance, the
+// node index and cluster name come from the cluster tags of the instance.
+// When CloudConfigTemplate is false the cloud-config is returned as it is.
+func RenderCloudConfig(instance Instance) ([]byte, error) {
+	if !instance.CloudConfigTemplate {
+		content, err := ioutil.ReadFile(instance.CloudConfig)
+		if err != nil {
+			return nil, &errs.ConfigError{Message: "Error reading cloud-config", Err: err}
+		}
+
+		return content, nil
+	}
+
+	cloudConfig, err := ParseCloudConfig(instance.CloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var userdata bytes.Buffer
+	err = cloudConfig.Execute(&userdata, TemplateData(instance))
+	if err != nil {
+		return nil, &errs.ConfigError{Message: "Error rendering cloud-config", Err: err}
+	}
+
+	return userdata.Bytes(), nil
+}
+
+// Find returns all instances that have all tags passed and are not
+// terminated or being terminated. Stopping and stopped instances are returned,
+// they keep their volumes and can be started again.
+func Find(ec2Ref *ec2ext.EC2, filterTags []ec2.Tag) ([]Instance, error) {
+	filter := tags.Filter(filterTags)
+	filter.Add("instance-state-name", "pending", "running", "stopping", "stopped")
+
+	var resp *ec2.InstancesResp
+	err := retry.Do("DescribeInstances", func() (err error) {
+		resp, err = ec2Ref.Instances(nil, filter)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]Instance, 0)
+	for _, reservation := range resp.Reservations {
+		for key := range reservation.Instances {
+			var instance Instance
+			mergeInstances(&instance, &reservation.Instances[key])
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+// Lookup loads the instance by its Id or, when the Id is missing, by its name
+func Lookup(ec2Ref *ec2ext.EC2, instance *Instance) error {
+	if instance.ID == "" {
+		instances, err := Find(ec2Ref, []ec2.Tag{{Key: "Name", Value: instance.Name}})
+		if err != nil {
+			return err
+		} else if len(instances) == 0 {
+			return &errs.NotFoundError{Err: fmt.Errorf("Any instance was found with name <%s>", instance.Name)}
+		} else if len(instances) > 1 {
+			return &errs.ConfigError{Message: fmt.Sprintf("There are %d instances with name <%s>, inform its Id", len(instances), instance.Name)}
+		}
+
+		instance.ID = instances[0].ID
+	}
+
+	_, err := Load(ec2Ref, instance)
+	return err
+}
+
+// Stop the instance and wait until it is stopped
+func Stop(ec2Ref *ec2ext.EC2, instance *Instance) error {
+	logger.Println("Stopping instance", instance.ID)
+	err := retry.Do("StopInstances", func() error {
+		_, err := ec2Ref.StopInstances(instance.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return WaitUntilState(ec2Ref, instance, "stopped")
+}
+
+// Start the instance and wait until it is running
+func Start(ec2Ref *ec2ext.EC2, instance *Instance) error {
+	logger.Println("Starting instance", instance.ID)
+	err := retry.Do("StartInstances", func() error {
+		_, err := ec2Ref.StartInstances(instance.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return WaitUntilState(ec2Ref, instance, "running")
+}
+
+// RunsFallbackType returns true when the instance has another type because it
+// was created with a fallback type of instanceType
+func RunsFallbackType(instance Instance, instanceType string) bool {
+	return instance.Type != instanceType && tags.Get(instance.Tags, tags.RequestedType) == instanceType
+}
+
+// LaunchTime returns when the instance was launched
+func LaunchTime(ec2Ref *ec2ext.EC2, instance Instance) (time.Time, error) {
+	var launchTimes map[string]time.Time
+	err := retry.Do("DescribeInstances", func() (err error) {
+		launchTimes, err = ec2Ref.LaunchTimes(instance.ID)
+		return
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	launchTime, ok := launchTimes[instance.ID]
+	if !ok {
+		return time.Time{}, &errs.NotFoundError{Resource: "instance", ID: instance.ID}
+	}
+
+	return launchTime, nil
+}
+
+// InstanceProfile returns the arn of the instance profile of the instance, the
+// IAM field of loaded instances has only the id of the profile
+func InstanceProfile(ec2Ref *ec2ext.EC2, instance Instance) (string, error) {
+	var profiles map[string]string
+	err := retry.Do("DescribeInstances", func() (err error) {
+		profiles, err = ec2Ref.InstanceProfiles(instance.ID)
+		return
+	})
+	if err != nil {
+		return "", err
+	}
+
+	arn, ok := profiles[instance.ID]
+	if !ok {
+		return "", &errs.NotFoundError{Resource: "instance", ID: instance.ID}
+	}
+
+	return arn, nil
+}
+
+// ebsOptimizedUnsupported are the instance types, or families when it ends
+// with a dot, that can't be EBS optimized
+var ebsOptimizedUnsupported = []string{"t1.", "t2.", "m1.small", "m1.medium", "m3.medium", "c1.medium", "cc2.8xlarge", "cr1.8xlarge", "hi1.4xlarge"}
+
+// SupportsEBSOptimized returns false if the instance type can't be EBS optimized
+func SupportsEBSOptimized(instanceType string) bool {
+	for _, unsupported := range ebsOptimizedUnsupported {
+		if instanceType == unsupported || (strings.HasSuffix(unsupported, ".") && strings.HasPrefix(instanceType, unsupported)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ChangeType stops the instance, changes its type and starts it again, the
+// volumes are kept attached. EBS optimization is changed to ebsOptimized too,
+// since some types don't support it. The instance must be loaded.
+func ChangeType(ec2Ref *ec2ext.EC2, instance *Instance, instanceType string, ebsOptimized bool) error {
+	if ebsOptimized && !SupportsEBSOptimized(instanceType) {
+		return &errs.ConfigError{Message: fmt.Sprintf("The instance <%s> must be EBS optimized, but the type <%s> doesn't support it", instance.ID, instanceType)}
+	}
+
+	logger.Printf("Changing type of instance <%s> from <%s> to <%s>\n", instance.ID, instance.Type, instanceType)
+
+	if instance.State.Name != "stopped" {
+		err := Stop(ec2Ref, instance)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the old type could not accept the change of EBS optimization, neither
+	// the new type, so it's disabled before and enabled after
+	if instance.EBSOptimized && !ebsOptimized {
+		err := modifyAttribute(ec2Ref, instance.ID, ec2ext.EBSOptimizedAttribute, "false")
+		if err != nil {
+			return err
+		}
+	}
+
+	err := modifyAttribute(ec2Ref, instance.ID, ec2ext.InstanceTypeAttribute, instanceType)
+	if err != nil {
+		return err
+	}
+
+	if !instance.EBSOptimized && ebsOptimized {
+		err = modifyAttribute(ec2Ref, instance.ID, ec2ext.EBSOptimizedAttribute, "true")
+		if err != nil {
+			return err
+		}
+	}
+
+	return Start(ec2Ref, instance)
+}
+
+func modifyAttribute(ec2Ref *ec2ext.EC2, instanceID, attribute, value string) error {
+	return retry.Do("ModifyInstanceAttribute", func() error {
+		_, err := ec2Ref.ModifyInstanceAttribute(instanceID, attribute, value)
+		return err
+	})
+}
+
+// TerminationProtected returns true when the termination protection of the
+// instance is on, instances are created with it unless EnableAPITermination
+func TerminationProtected(ec2Ref *ec2ext.EC2, instance Instance) (bool, error) {
+	var protected bool
+	err := retry.Do("DescribeInstanceAttribute", func() (err error) {
+		protected, err = ec2Ref.DisableAPITermination(instance.ID)
+		return
+	})
+
+	return protected, err
+}
+
+// SetTerminationProtection turns the termination protection of the instance
+// on or off
+func SetTerminationProtection(ec2Ref *ec2ext.EC2, instance Instance, protected bool) error {
+	return modifyAttribute(ec2Ref, instance.ID, ec2ext.DisableAPITerminationAttribute, strconv.FormatBool(protected))
+}
+
 // Terminate ...
-func Terminate(ec2Ref *ec2.EC2, instance Instance) error {
+func Terminate(ec2Ref *ec2ext.EC2, instance Instance) error {
 	logger.Println("Terminating instance", instance.ID)
-	_, err := ec2Ref.TerminateInstances([]string{instance.ID})
+	err := retry.Do("TerminateInstances", func() error {
+		_, err := ec2Ref.TerminateInstances([]string{instance.ID})
+		return err
+	})
 	if err == nil {
 		logger.Printf("Instance <%s> was destroyed!\n", instance.ID)
 	}
@@ -217,9 +603,21 @@ func Terminate(ec2Ref *ec2.EC2, instance Instance) error {
 	return err
 }
 
-// Reboot ...
-func Reboot(ec2Ref *ec2.EC2, instance Instance) error {
+// RebootDelay is how long Reboot waits for the instance to start rebooting
+var RebootDelay = 30 * time.Second
+
+// Reboot the instance and wait a while, so the instance is not checked
+// before it starts rebooting
+func Reboot(ec2Ref *ec2ext.EC2, instance Instance) error {
 	logger.Println("Rebooting instance", instance.ID)
-	_, err := ec2Ref.RebootInstances(instance.InstanceId)
-	return err
+	err := retry.Do("RebootInstances", func() error {
+		_, err := ec2Ref.RebootInstances(instance.InstanceId)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(RebootDelay)
+	return nil
 }
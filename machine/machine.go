@@ -1,17 +1,25 @@
 package machine
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/NeowayLabs/cloud-machine/ec2ext"
+	"github.com/NeowayLabs/cloud-machine/errs"
 	"github.com/NeowayLabs/cloud-machine/instance"
+	"github.com/NeowayLabs/cloud-machine/retry"
+	"github.com/NeowayLabs/cloud-machine/snapshot"
+	"github.com/NeowayLabs/cloud-machine/tags"
 	"github.com/NeowayLabs/cloud-machine/volume"
 	"gopkg.in/amz.v3/aws"
 	"gopkg.in/amz.v3/ec2"
+	"gopkg.in/yaml.v2"
 )
 
 const (
@@ -19,6 +27,10 @@ const (
 	DefaultFormatInstanceType    = "t2.micro"
 )
 
+// FormatTimeout is how long the instance that formats the volumes has to
+// finish, it terminates itself after formatting them
+var FormatTimeout = 30 * time.Minute
+
 var output io.Writer = os.Stderr
 var logger = log.New(output, "", 0)
 
@@ -28,34 +40,134 @@ func SetLogger(out io.Writer, prefix string, flag int) {
 	logger = log.New(out, prefix, flag)
 	instance.SetLogger(out, prefix, flag)
 	volume.SetLogger(out, prefix, flag)
+	snapshot.SetLogger(out, prefix, flag)
+	retry.SetLogger(out, prefix, flag)
 }
 
 // Machine ...
 type Machine struct {
 	Instance instance.Instance
 	Volumes  []volume.Volume
+	Options  Options `yaml:"-"` // passed by the commands, they aren't in the machine file
+}
+
+// Options changes how the machine is updated
+type Options struct {
+	AllowDowntime bool // the instance can be stopped to change its type
+	UndoFallback  bool // the type of an instance created with a fallback type is changed too
+	Replace       bool // the instance can be replaced to change its image
+}
+
+// EC2 returns a ec2 client of region
+func EC2(region string, auth aws.Auth) *ec2ext.EC2 {
+	return ec2ext.New(auth, aws.Regions[region])
+}
+
+// Load reads a machine file
+func Load(machineFile string) (Machine, error) {
+	var machineConfig Machine
+
+	machineContent, err := ioutil.ReadFile(machineFile)
+	if err != nil {
+		return machineConfig, err
+	}
+
+	err = yaml.Unmarshal(machineContent, &machineConfig)
+	return machineConfig, err
 }
 
 // Get ...
 func Get(machine *Machine, auth aws.Auth) error {
-	ec2Ref := ec2.New(auth, aws.Regions[machine.Instance.Region], aws.SignV4Factory(machine.Instance.Region, "ec2"))
+	ec2Ref := EC2(machine.Instance.Region, auth)
 
 	// Verify if cloud-config file exists
 	if machine.Instance.CloudConfig != "" {
 		_, err := os.Stat(machine.Instance.CloudConfig)
+		if err != nil {
+			return &errs.ConfigError{Message: "Error reading cloud-config", Err: err}
+		}
+	}
+
+	switch machine.Instance.Reboot {
+	case "", instance.RebootNever, instance.RebootAlways, instance.RebootIfAttached:
+	default:
+		return &errs.ConfigError{Message: fmt.Sprintf("Invalid reboot <%s> of instance <%s>", machine.Instance.Reboot, machine.Instance.Name)}
+	}
+
+	err := findNode(ec2Ref, machine)
+	if err != nil {
+		return err
+	}
+
+	// existing volumes are loaded first, a new instance must be created in
+	// the same available zone of them
+	volumesToFormat := make([]volume.Volume, 0)
+	for key := range machine.Volumes {
+		volumeConfig := &machine.Volumes[key]
+		if volumeConfig.ID == "" {
+			continue
+		}
+
+		_, err := volume.Get(ec2Ref, volumeConfig)
+		if err != nil {
+			return err
+		}
+
+		// a run that failed before formatting could leave the volume behind
+		if tags.Get(volumeConfig.Tags, tags.Formatted) == "false" {
+			if volumeConfig.Status != "available" {
+				return fmt.Errorf("The volume <%s> was not formatted, but it's <%s> and can't be attached to the format instance", volumeConfig.ID, volumeConfig.Status)
+			}
+
+			volumesToFormat = append(volumesToFormat, *volumeConfig)
+		}
+
+		if machine.Instance.ID == "" {
+			err = pinAvailableZone(&machine.Instance, volumeConfig.AvailableZone)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the instance is created before the new volumes because the available
+	// zone could change when aws doesn't have capacity
+	existing := machine.Instance.ID != ""
+	instanceType := machine.Instance.Type
+	ebsOptimized := machine.Instance.EBSOptimized
+	imageID := machine.Instance.ImageID
+	machine.Instance.UserData.Volumes = machine.Volumes
+	_, err = instance.Get(ec2Ref, &machine.Instance)
+	if err != nil {
+		return err
+	}
+
+	// a new instance is booting, an existing one only when its type changes
+	booted := !existing
+	if existing {
+		liveType := machine.Instance.Type
+		err = changeType(ec2Ref, machine, instanceType, ebsOptimized)
 		if err != nil {
 			return err
 		}
+		booted = machine.Instance.Type != liveType
+
+		if imageID != "" && imageID != machine.Instance.ImageID {
+			logger.Printf("The instance <%s> uses the image <%s> instead of <%s>, it must be replaced to use the new image\n", machine.Instance.ID, machine.Instance.ImageID, imageID)
+		}
 	}
 
 	// get list of volumes to format
-	volumesToFormat := make([]volume.Volume, 0)
 	for key := range machine.Volumes {
 		volumeConfig := &machine.Volumes[key]
+		if volumeConfig.ID != "" {
+			continue
+		}
 
 		format := false
-		if volumeConfig.ID == "" && volumeConfig.SnapshotID == "" {
+		if volumeConfig.SnapshotID == "" {
 			format = true
+			volumeConfig.Tags = tags.Set(volumeConfig.Tags, tags.Formatted, "false")
 		}
 
 		volumeConfig.AvailableZone = machine.Instance.AvailableZone
@@ -76,45 +188,652 @@ func Get(machine *Machine, auth aws.Auth) error {
 		if err != nil {
 			return err
 		}
+
+		for key := range machine.Volumes {
+			if tags.Get(machine.Volumes[key].Tags, tags.Formatted) == "false" {
+				machine.Volumes[key].Tags = tags.Set(machine.Volumes[key].Tags, tags.Formatted, "true")
+			}
+		}
 	}
 
-	_, err := instance.Get(ec2Ref, &machine.Instance)
+	attached, err := AttachVolumes(ec2Ref, machine.Instance.ID, machine.Volumes)
 	if err != nil {
 		return err
 	}
 
-	err = AttachVolumes(ec2Ref, machine.Instance.ID, machine.Volumes)
+	reboot := false
+	switch machine.Instance.Reboot {
+	case instance.RebootAlways:
+		reboot = true
+	case instance.RebootNever:
+	default:
+		reboot = !existing && attached > 0
+		if existing && attached > 0 {
+			logger.Printf("%d volume(s) were attached to the running instance <%s>, they are mounted on the next reboot\n", attached, machine.Instance.ID)
+		}
+	}
+
+	if reboot {
+		err = instance.Reboot(ec2Ref, machine.Instance)
+		if err != nil {
+			return err
+		}
+	}
+
+	// running doesn't mean the instance can be used, it could be still booting
+	if booted || reboot {
+		err = instance.WaitUntilHealthy(ec2Ref, machine.Instance, machine.Instance.Readiness)
+		if err != nil {
+			return instance.WithConsoleOutput(ec2Ref, machine.Instance, err)
+		}
+	}
+
+	logger.Printf("The instance Id <%s> with IP Address <%s> is running with %d volume(s)!\n", machine.Instance.ID, machine.Instance.PrivateIPAddress, len(machine.Volumes))
+
+	return nil
+}
+
+// ChangeType changes the type of the existing instance of the machine to the
+// type of the machine file, when they are different. The instance is stopped,
+// so it's changed only when the downtime is allowed by the options.
+func ChangeType(machine *Machine, auth aws.Auth) error {
+	ec2Ref := EC2(machine.Instance.Region, auth)
+
+	instanceType := machine.Instance.Type
+	ebsOptimized := machine.Instance.EBSOptimized
+	_, err := instance.Load(ec2Ref, &machine.Instance)
 	if err != nil {
 		return err
 	}
 
-	err = instance.Reboot(ec2Ref, machine.Instance)
+	return changeType(ec2Ref, machine, instanceType, ebsOptimized)
+}
+
+func changeType(ec2Ref *ec2ext.EC2, machine *Machine, instanceType string, ebsOptimized bool) error {
+	if instanceType == "" || instanceType == machine.Instance.Type {
+		return nil
+	}
+
+	if !machine.Options.UndoFallback && instance.RunsFallbackType(machine.Instance, instanceType) {
+		logger.Printf("The instance <%s> was created as <%s> because aws didn't have capacity of <%s>\n", machine.Instance.ID, machine.Instance.Type, instanceType)
+		return nil
+	}
+
+	if !machine.Options.AllowDowntime {
+		logger.Printf("The instance <%s> is <%s> instead of <%s>, the downtime must be allowed to change it\n", machine.Instance.ID, machine.Instance.Type, instanceType)
+		return nil
+	}
+
+	return instance.ChangeType(ec2Ref, &machine.Instance, instanceType, ebsOptimized)
+}
+
+// pinAvailableZone keeps only the placements of the instance that are in the
+// available zone passed
+func pinAvailableZone(instanceConfig *instance.Instance, availableZone string) error {
+	placements := append([]instance.Placement{{AvailableZone: instanceConfig.AvailableZone, SubnetID: instanceConfig.SubnetID}}, instanceConfig.FallbackPlacements...)
+
+	pinned := make([]instance.Placement, 0)
+	for _, placement := range placements {
+		if placement.AvailableZone == availableZone {
+			pinned = append(pinned, placement)
+		}
+	}
+
+	if len(pinned) == 0 {
+		return &errs.ConfigError{Message: fmt.Sprintf("The volumes of <%s> are in <%s>, but the instance doesn't have a placement in this available zone", instanceConfig.Name, availableZone)}
+	}
+
+	instanceConfig.AvailableZone = pinned[0].AvailableZone
+	instanceConfig.SubnetID = pinned[0].SubnetID
+	instanceConfig.FallbackPlacements = pinned[1:]
+
+	return nil
+}
+
+// findNode looks for the instance and volumes of a cluster node by its
+// cluster and node tags, when the instance of the node is missing a new one
+// is created and the existing volumes are attached to it
+func findNode(ec2Ref *ec2ext.EC2, machine *Machine) error {
+	clusterName := tags.Get(machine.Instance.Tags, tags.Cluster)
+	node := tags.Get(machine.Instance.Tags, tags.Node)
+	if clusterName == "" || node == "" {
+		return nil
+	}
+
+	nodeTags := []ec2.Tag{{Key: tags.Cluster, Value: clusterName}, {Key: tags.Node, Value: node}}
+
+	if machine.Instance.ID == "" {
+		instances, err := instance.Find(ec2Ref, nodeTags)
+		if err != nil {
+			return err
+		} else if len(instances) > 1 {
+			return &errs.ConfigError{Message: fmt.Sprintf("There are %d instances of node %s of cluster <%s>", len(instances), node, clusterName)}
+		} else if len(instances) == 1 {
+			machine.Instance.ID = instances[0].ID
+		}
+	}
+
+	for key := range machine.Volumes {
+		volumeConfig := &machine.Volumes[key]
+		if volumeConfig.ID != "" || volumeConfig.SnapshotID != "" {
+			continue
+		}
+
+		volumeTags := append(nodeTags, ec2.Tag{Key: tags.Volume, Value: tags.Get(volumeConfig.Tags, tags.Volume)})
+		volumes, err := volume.Find(ec2Ref, volumeTags)
+		if err != nil {
+			return err
+		} else if len(volumes) > 1 {
+			return &errs.ConfigError{Message: fmt.Sprintf("There are %d volumes <%s> of node %s of cluster <%s>", len(volumes), volumeConfig.Name, node, clusterName)}
+		} else if len(volumes) == 1 {
+			logger.Printf("Using existing volume <%s> as <%s>\n", volumes[0].ID, volumeConfig.Name)
+			volumeConfig.ID = volumes[0].ID
+		}
+	}
+
+	return nil
+}
+
+// Lookup loads the instance and volumes of the machine that already exist
+// without creating anything. The instance is found by its Id, its node tags
+// or its name and the volumes by their Id, their node tags or the device they
+// are attached to the instance, resources not found keep an empty Id.
+func Lookup(machine *Machine, auth aws.Auth) error {
+	ec2Ref := EC2(machine.Instance.Region, auth)
+
+	err := findNode(ec2Ref, machine)
 	if err != nil {
 		return err
 	}
 
-	logger.Printf("The instance Id <%s> with IP Address <%s> is running with %d volume(s)!\n", machine.Instance.ID, machine.Instance.PrivateIPAddress, len(machine.Volumes))
+	// nodes of a cluster are found only by their tags
+	if machine.Instance.ID != "" || (machine.Instance.Name != "" && tags.Get(machine.Instance.Tags, tags.Cluster) == "") {
+		err = instance.Lookup(ec2Ref, &machine.Instance)
+
+		var notFoundError *errs.NotFoundError
+		if errors.As(err, &notFoundError) {
+			machine.Instance.ID = ""
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if machine.Instance.ID != "" {
+		attached, err := volume.Attached(ec2Ref, machine.Instance.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, volumeInfo := range attached {
+			volumeConfig := findVolumeByDevice(machine.Volumes, volumeInfo)
+			if volumeConfig != nil && volumeConfig.ID == "" {
+				volumeConfig.ID = volumeInfo.ID
+			}
+		}
+	}
+
+	for key := range machine.Volumes {
+		volumeConfig := &machine.Volumes[key]
+		if volumeConfig.ID == "" {
+			continue
+		}
+
+		_, err := volume.Load(ec2Ref, volumeConfig)
+
+		var notFoundError *errs.NotFoundError
+		if errors.As(err, &notFoundError) {
+			volumeConfig.ID = ""
+		} else if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-// AttachVolumes ...
-func AttachVolumes(ec2Ref *ec2.EC2, InstanceID string, volumes []volume.Volume) error {
-	for _, volumeConfig := range volumes {
-		_, err := ec2Ref.AttachVolume(volumeConfig.ID, InstanceID, volumeConfig.Device)
+// Destroy terminates the instance of the machine, before that each volume
+// attached to it is kept, snapshotted or deleted following its OnDestroy.
+// Volumes kept or snapshotted are detached with the instance stopped.
+func Destroy(machine *Machine, auth aws.Auth) error {
+	ec2Ref := EC2(machine.Instance.Region, auth)
+
+	err := instance.Lookup(ec2Ref, &machine.Instance)
+	if err != nil {
+		return err
+	}
+
+	// the instance is stopped and its volumes detached before terminating it,
+	// so the termination protection is checked before changing anything
+	err = checkTermination(ec2Ref, machine.Instance)
+	if err != nil {
+		return err
+	}
+
+	attached, err := volume.Attached(ec2Ref, machine.Instance.ID)
+	if err != nil {
+		return err
+	}
+
+	volumesToDetach := make([]volume.Volume, 0)
+	for _, volumeInfo := range attached {
+		volumeConfig := findVolumeByDevice(machine.Volumes, volumeInfo)
+		if volumeConfig == nil {
+			// volumes that aren't in the machine file follow the aws defaults
+			continue
+		}
+
+		switch volumeConfig.OnDestroy {
+		case "", volume.OnDestroyKeep, volume.OnDestroySnapshot, volume.OnDestroyDelete:
+		default:
+			return &errs.ConfigError{Message: fmt.Sprintf("Invalid ondestroy <%s> of volume <%s>", volumeConfig.OnDestroy, volumeConfig.Name)}
+		}
+
+		// snapshots are found by the cloud-machine tags, volumes created before
+		// them only have these tags in the machine file
+		volumeInfo.Tags = tags.Merge(volumeInfo.Tags, volumeConfig.Tags)
+		volumeInfo.OnDestroy = volumeConfig.OnDestroy
+		volumesToDetach = append(volumesToDetach, volumeInfo)
+	}
+
+	if len(volumesToDetach) > 0 && machine.Instance.State.Name != "stopped" {
+		err = instance.Stop(ec2Ref, &machine.Instance)
+		if err != nil {
+			return err
+		}
+	}
+
+	volumesToDelete := make([]volume.Volume, 0)
+	for key := range volumesToDetach {
+		volumeInfo := &volumesToDetach[key]
+
+		err = volume.Detach(ec2Ref, volumeInfo)
 		if err != nil {
-			reqError := err.(*ec2.Error)
-			if reqError.Code != "VolumeInUse" {
+			return err
+		}
+
+		switch volumeInfo.OnDestroy {
+		case volume.OnDestroySnapshot:
+			description := fmt.Sprintf("%s of %s", volumeInfo.Name, machine.Instance.Name)
+			snapshotInfo, err := snapshot.Create(ec2Ref, volumeInfo.ID, description, tags.Set(volumeInfo.Tags, "Name", volumeInfo.Name))
+			if err != nil {
 				return err
 			}
+
+			logger.Printf("Volume <%s> was saved in snapshot <%s>\n", volumeInfo.ID, snapshotInfo.Id)
+			volumesToDelete = append(volumesToDelete, *volumeInfo)
+		case volume.OnDestroyDelete:
+			volumesToDelete = append(volumesToDelete, *volumeInfo)
+		default:
+			logger.Printf("Volume <%s> was kept\n", volumeInfo.ID)
+		}
+	}
+
+	err = instance.Terminate(ec2Ref, machine.Instance)
+	if err != nil {
+		return err
+	}
+
+	err = instance.WaitUntilState(ec2Ref, &machine.Instance, "terminated")
+	if err != nil {
+		return err
+	}
+
+	for _, volumeInfo := range volumesToDelete {
+		err = volume.Delete(ec2Ref, volumeInfo)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// FormatVolumes ...
-func FormatVolumes(ec2Ref *ec2.EC2, machine Machine, volumes []volume.Volume) error {
+// CheckTermination returns a ConfigError when the instance of the machine has
+// termination protection, so Destroy would fail. The instance Id must be set.
+func CheckTermination(machine Machine, auth aws.Auth) error {
+	return checkTermination(EC2(machine.Instance.Region, auth), machine.Instance)
+}
+
+// checkTermination returns a ConfigError when the instance has termination
+// protection, since terminating it would fail
+func checkTermination(ec2Ref *ec2ext.EC2, instanceInfo instance.Instance) error {
+	protected, err := instance.TerminationProtected(ec2Ref, instanceInfo)
+	if err != nil {
+		return err
+	}
+
+	if protected {
+		return &errs.ConfigError{Message: fmt.Sprintf("The instance <%s> has termination protection, disable it to terminate the instance", instanceInfo.ID)}
+	}
+
+	return nil
+}
+
+// Replace launches a new instance with the image of the machine file when the
+// existing instance uses another image. The volumes of the machine are
+// detached from the old instance, with it stopped, and attached to the new
+// one, after that the old instance is terminated. Nothing is done when the
+// instance doesn't exist or it already uses the image.
+//
+// The new instance gets the name and tags of the node only after the old one
+// is terminated, so the node never has two instances. When a step fails
+// before that, the new instance is terminated and the volumes are attached to
+// the old instance again. Both must be terminated by the api, so an old
+// instance with termination protection is refused and the new one is
+// protected only after it's tagged as the node.
+func Replace(machine *Machine, auth aws.Auth) error {
+	ec2Ref := EC2(machine.Instance.Region, auth)
+
+	old := *machine
+	old.Volumes = make([]volume.Volume, len(machine.Volumes))
+	copy(old.Volumes, machine.Volumes)
+
+	err := Lookup(&old, auth)
+	if err != nil {
+		return err
+	}
+
+	if old.Instance.ID == "" || old.Instance.ImageID == machine.Instance.ImageID {
+		return nil
+	}
+
+	if machine.Instance.PrivateIP != "" {
+		return &errs.ConfigError{Message: fmt.Sprintf("The instance <%s> has a fixed private IP, it can't be replaced", old.Instance.ID)}
+	}
+
+	err = checkTermination(ec2Ref, old.Instance)
+	if err != nil {
+		return err
+	}
+
+	logger.Printf("Replacing instance <%s> of image <%s> by a new one of image <%s>\n", old.Instance.ID, old.Instance.ImageID, machine.Instance.ImageID)
+
+	// the volumes of the old instance are moved, so the new instance must be
+	// in the same available zone
+	newInstance := machine.Instance
+	newInstance.ID = ""
+	err = pinAvailableZone(&newInstance, old.Instance.AvailableZone)
+	if err != nil {
+		return err
+	}
+
+	volumesToMove := make([]volume.Volume, 0)
+	for key := range old.Volumes {
+		volumeInfo := old.Volumes[key]
+		if volumeInfo.ID == "" {
+			continue
+		}
+
+		for _, attachment := range volumeInfo.Attachments {
+			if attachment.InstanceId == old.Instance.ID {
+				volumesToMove = append(volumesToMove, volumeInfo)
+			}
+		}
+
+		machine.Volumes[key].ID = volumeInfo.ID
+	}
+
+	// the cloud-config is rendered with the values of the node, but the
+	// instance is launched without its name and cloud-machine tags
+	newInstance.UserData.Volumes = machine.Volumes
+	newInstance.UserData = instance.TemplateData(newInstance)
+	newInstance.Name = machine.Instance.Name + "-replacement"
+	newInstance.Tags = tags.Remove(machine.Instance.Tags, tags.Cluster, tags.Node)
+	newInstance.EnableAPITermination = true
+	_, err = instance.Create(ec2Ref, &newInstance)
+	if err != nil {
+		return err
+	}
+
+	running := old.Instance.State.Name != "stopped"
+	detached := make([]volume.Volume, 0)
+	rollback := func(err error) error {
+		logger.Printf("Error replacing instance <%s>, rolling back: %s\n", old.Instance.ID, err.Error())
+		rollbackErr := rollbackReplace(ec2Ref, old.Instance, newInstance, detached, running)
+		if rollbackErr != nil {
+			return fmt.Errorf("%s, the rollback failed too: %s", err.Error(), rollbackErr.Error())
+		}
+
+		return err
+	}
+
+	if len(volumesToMove) > 0 && running {
+		err = instance.Stop(ec2Ref, &old.Instance)
+		if err != nil {
+			return rollback(err)
+		}
+	}
+
+	for key := range volumesToMove {
+		err = volume.Detach(ec2Ref, &volumesToMove[key])
+		if err != nil {
+			return rollback(err)
+		}
+
+		detached = append(detached, volumesToMove[key])
+	}
+
+	_, err = AttachVolumes(ec2Ref, newInstance.ID, volumesToMove)
+	if err != nil {
+		return rollback(err)
+	}
+
+	// the cloud-config mounts the volumes on boot
+	if len(volumesToMove) > 0 {
+		err = instance.Reboot(ec2Ref, newInstance)
+		if err != nil {
+			return rollback(err)
+		}
+	}
+
+	err = instance.Terminate(ec2Ref, old.Instance)
+	if err != nil {
+		return rollback(err)
+	}
+
+	// instances being terminated are not found as the node anymore
+	nodeTags := tags.Set(machine.Instance.Tags, "Name", machine.Instance.Name)
+	err = retry.Do("CreateTags", func() error {
+		_, err := ec2Ref.CreateTags([]string{newInstance.ID}, nodeTags)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("The instance <%s> replaced <%s>, but it wasn't tagged as the node: %s", newInstance.ID, old.Instance.ID, err.Error())
+	}
+
+	newInstance.Name = machine.Instance.Name
+	newInstance.Tags = tags.Merge(newInstance.Tags, machine.Instance.Tags)
+	newInstance.EnableAPITermination = machine.Instance.EnableAPITermination
+	machine.Instance = newInstance
+
+	if !newInstance.EnableAPITermination {
+		err = instance.SetTerminationProtection(ec2Ref, newInstance, true)
+		if err != nil {
+			return fmt.Errorf("The instance <%s> replaced <%s>, but its termination protection wasn't turned on: %s", newInstance.ID, old.Instance.ID, err.Error())
+		}
+	}
+
+	err = instance.WaitUntilState(ec2Ref, &old.Instance, "terminated")
+	if err != nil {
+		return err
+	}
+	logger.Printf("The instance <%s> was replaced by <%s>\n", old.Instance.ID, newInstance.ID)
+
+	return nil
+}
+
+// rollbackReplace terminates the new instance of a failed replace, attaches
+// the detached volumes to the old instance again and starts it when it was
+// running
+func rollbackReplace(ec2Ref *ec2ext.EC2, oldInstance instance.Instance, newInstance instance.Instance, detached []volume.Volume, running bool) error {
+	err := instance.Terminate(ec2Ref, newInstance)
+	if err != nil {
+		return err
+	}
+
+	err = instance.WaitUntilState(ec2Ref, &newInstance, "terminated")
+	if err != nil {
+		return err
+	}
+
+	// the volumes could be attached to the new instance already
+	for key := range detached {
+		_, err = volume.Load(ec2Ref, &detached[key])
+		if err != nil {
+			return err
+		}
+
+		err = volume.WaitUntilState(ec2Ref, &detached[key], "available")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = AttachVolumes(ec2Ref, oldInstance.ID, detached)
+	if err != nil {
+		return err
+	}
+
+	if running {
+		err = instance.Start(ec2Ref, &oldInstance)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MoveVolume detaches the volume name of machine from and attaches it to the
+// machine to, both instances must be in the same available zone. The volume is
+// attached to the device that the machine to has to this volume name or, if it
+// doesn't have it, to the same device. If stopSource is true the instance of
+// machine from is stopped before detaching the volume.
+func MoveVolume(from, to *Machine, name string, stopSource bool, auth aws.Auth) error {
+	if from.Instance.Region != to.Instance.Region {
+		return &errs.ConfigError{Message: fmt.Sprintf("Cannot move volume from region <%s> to <%s>", from.Instance.Region, to.Instance.Region)}
+	}
+
+	ec2Ref := EC2(from.Instance.Region, auth)
+
+	var volumeConfig *volume.Volume
+	for key := range from.Volumes {
+		if from.Volumes[key].Name == name {
+			volumeConfig = &from.Volumes[key]
+		}
+	}
+
+	if volumeConfig == nil {
+		return &errs.ConfigError{Message: fmt.Sprintf("Machine <%s> doesn't have the volume <%s>", from.Instance.Name, name)}
+	}
+
+	device := volumeConfig.Device
+	for _, targetConfig := range to.Volumes {
+		if targetConfig.Name == name {
+			device = targetConfig.Device
+		}
+	}
+
+	err := instance.Lookup(ec2Ref, &from.Instance)
+	if err != nil {
+		return err
+	}
+
+	err = instance.Lookup(ec2Ref, &to.Instance)
+	if err != nil {
+		return err
+	}
+
+	attached, err := volume.Attached(ec2Ref, from.Instance.ID)
+	if err != nil {
+		return err
+	}
+
+	var volumeInfo *volume.Volume
+	for key := range attached {
+		if findVolumeByDevice([]volume.Volume{*volumeConfig}, attached[key]) != nil {
+			volumeInfo = &attached[key]
+		}
+	}
+
+	if volumeInfo == nil {
+		return &errs.NotFoundError{Err: fmt.Errorf("The volume <%s> isn't attached to instance <%s> on device <%s>", name, from.Instance.ID, volumeConfig.Device)}
+	}
+
+	if volumeInfo.AvailableZone != to.Instance.AvailableZone {
+		return &errs.ConfigError{Message: fmt.Sprintf("The volume <%s> is in <%s> and instance <%s> is in <%s>", volumeInfo.ID, volumeInfo.AvailableZone, to.Instance.ID, to.Instance.AvailableZone)}
+	}
+
+	if stopSource && from.Instance.State.Name != "stopped" {
+		err = instance.Stop(ec2Ref, &from.Instance)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = volume.Detach(ec2Ref, volumeInfo)
+	if err != nil {
+		return err
+	}
+
+	volumeInfo.Device = device
+	_, err = AttachVolumes(ec2Ref, to.Instance.ID, []volume.Volume{*volumeInfo})
+	if err != nil {
+		return err
+	}
+
+	logger.Printf("The volume <%s> was moved from instance <%s> to <%s> on device <%s>\n", volumeInfo.ID, from.Instance.ID, to.Instance.ID, device)
+
+	return nil
+}
+
+func findVolumeByDevice(volumes []volume.Volume, volumeInfo volume.Volume) *volume.Volume {
+	for _, attachment := range volumeInfo.Attachments {
+		for key := range volumes {
+			if volume.SameDevice(volumes[key].Device, attachment.Device) {
+				return &volumes[key]
+			}
+		}
+	}
+
+	return nil
+}
+
+// AttachVolumes attaches the volumes to the instance and waits until all of
+// them are attached, it returns how many volumes were attached now. A volume
+// already attached is accepted only when it is attached to this instance on
+// the same device.
+func AttachVolumes(ec2Ref *ec2ext.EC2, InstanceID string, volumes []volume.Volume) (int, error) {
+	attached := 0
+	for key := range volumes {
+		volumeConfig := &volumes[key]
+
+		err := retry.Do("AttachVolume", func() error {
+			_, err := ec2Ref.AttachVolume(volumeConfig.ID, InstanceID, volumeConfig.Device)
+			return err
+		})
+		if err == nil {
+			attached++
+		} else {
+			// the volume could be attached to this instance already
+			var attachedError *errs.AlreadyAttachedError
+			if !errors.As(err, &attachedError) {
+				return attached, err
+			}
+		}
+
+		err = volume.WaitUntilAttached(ec2Ref, volumeConfig, InstanceID, volumeConfig.Device)
+		if err != nil {
+			return attached, err
+		}
+	}
+
+	return attached, nil
+}
+
+// FormatVolumes formats the volumes in a temporary instance and tags them as
+// formatted
+func FormatVolumes(ec2Ref *ec2ext.EC2, machine Machine, volumes []volume.Volume) error {
 	err := os.Mkdir("cloud-config", 0755)
 	if os.IsPermission(err) == true {
 		return err
@@ -144,6 +863,8 @@ func FormatVolumes(ec2Ref *ec2.EC2, machine Machine, volumes []volume.Volume) er
 		SubnetID:         machine.Instance.SubnetID,
 		AvailableZone:    machine.Instance.AvailableZone,
 		ShutdownBehavior: "terminate",
+		// it's terminated when the format doesn't finish
+		EnableAPITermination: true,
 	}
 
 	_, err = instance.Get(ec2Ref, &formatInstance)
@@ -151,7 +872,7 @@ func FormatVolumes(ec2Ref *ec2.EC2, machine Machine, volumes []volume.Volume) er
 		return err
 	}
 
-	err = AttachVolumes(ec2Ref, formatInstance.ID, volumes)
+	_, err = AttachVolumes(ec2Ref, formatInstance.ID, volumes)
 	if err != nil {
 		return err
 	}
@@ -162,12 +883,54 @@ func FormatVolumes(ec2Ref *ec2.EC2, machine Machine, volumes []volume.Volume) er
 	}
 
 	logger.Printf("Waiting while %d volumes was formating...\n", len(volumes))
-	err = instance.WaitUntilState(ec2Ref, &formatInstance, "terminated")
+	err = instance.WaitUntilStateTimeout(ec2Ref, &formatInstance, "terminated", FormatTimeout)
 	logger.Println("")
 	if err != nil {
+		err = instance.WithConsoleOutput(ec2Ref, formatInstance, err)
+		cleanupErr := terminateFormatInstance(ec2Ref, formatInstance, volumes)
+		if cleanupErr != nil {
+			return fmt.Errorf("%s, the format instance wasn't terminated: %s", err.Error(), cleanupErr.Error())
+		}
+
 		return err
 	}
 
+	// only now a failed run can use the volumes without formatting them
+	for key := range volumes {
+		err = volume.SetTag(ec2Ref, &volumes[key], tags.Formatted, "true")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// terminateFormatInstance terminates the format instance and waits until the
+// volumes are available, so the next run can attach them and format them again
+func terminateFormatInstance(ec2Ref *ec2ext.EC2, formatInstance instance.Instance, volumes []volume.Volume) error {
+	err := instance.Terminate(ec2Ref, formatInstance)
+	if err != nil {
+		return err
+	}
+
+	err = instance.WaitUntilState(ec2Ref, &formatInstance, "terminated")
+	if err != nil {
+		return err
+	}
+
+	for key := range volumes {
+		_, err = volume.Load(ec2Ref, &volumes[key])
+		if err != nil {
+			return err
+		}
+
+		err = volume.WaitUntilState(ec2Ref, &volumes[key], "available")
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,96 @@
+package retry
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"time"
+
+	"github.com/NeowayLabs/cloud-machine/errs"
+	"gopkg.in/amz.v3/ec2"
+)
+
+var (
+	// MaxAttempts is how many times a request is done before giving up
+	MaxAttempts = 6
+	// BaseDelay is the delay before the first retry, it doubles on each retry
+	BaseDelay = 500 * time.Millisecond
+	// MaxDelay is the maximum delay between two attempts
+	MaxDelay = 30 * time.Second
+)
+
+var loggerOutput io.Writer = os.Stderr
+var logger = log.New(loggerOutput, "", 0)
+
+// SetLogger ...
+func SetLogger(out io.Writer, prefix string, flag int) {
+	loggerOutput = out
+	logger = log.New(out, prefix, flag)
+}
+
+// Do calls request until it succeeds, it returns an error that is not
+// transient or MaxAttempts is reached. Only requests that can be repeated
+// safely should use it, see DoThrottled.
+func Do(name string, request func() error) error {
+	return do(name, request, Retryable)
+}
+
+// DoThrottled calls request again only when aws throttled it, in this case
+// the request was not executed. It should be used by requests that create
+// resources, since a server error doesn't mean that nothing was created.
+func DoThrottled(name string, request func() error) error {
+	return do(name, request, throttled)
+}
+
+func do(name string, request func() error, retryable func(error) bool) error {
+	for attempt := 1; ; attempt++ {
+		err := errs.Wrap(request())
+		if err == nil || attempt >= MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		delay := backoff(attempt)
+		logger.Printf("%s failed (attempt %d of %d), trying again in %s: %s\n", name, attempt, MaxAttempts, delay, err.Error())
+		time.Sleep(delay)
+	}
+}
+
+// backoff returns a random delay between the half and the whole exponential
+// delay of the attempt
+func backoff(attempt int) time.Duration {
+	delay := MaxDelay
+	if attempt < 16 && BaseDelay<<uint(attempt-1) < MaxDelay {
+		delay = BaseDelay << uint(attempt-1)
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Retryable returns true if err is transient: throttling, aws internal errors
+// and network errors
+func Retryable(err error) bool {
+	if throttled(err) {
+		return true
+	}
+
+	var reqError *ec2.Error
+	if errors.As(err, &reqError) {
+		switch reqError.Code {
+		case "InternalError", "InternalFailure", "ServiceUnavailable", "Unavailable":
+			return true
+		}
+
+		return reqError.StatusCode >= 500
+	}
+
+	var netError net.Error
+	return errors.As(err, &netError)
+}
+
+func throttled(err error) bool {
+	var throttledError *errs.ThrottledError
+	return errors.As(err, &throttledError)
+}
@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NeowayLabs/cloud-machine/errs"
+	"gopkg.in/amz.v3/ec2"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, BaseDelay},
+		{2, 2 * BaseDelay},
+		{3, 4 * BaseDelay},
+		{6, 32 * BaseDelay},
+		{7, MaxDelay},
+		{20, MaxDelay},
+		{100, MaxDelay},
+	}
+
+	for _, test := range tests {
+		// the delay is random, so it's checked many times
+		for i := 0; i < 100; i++ {
+			delay := backoff(test.attempt)
+			if delay < test.max/2 || delay > test.max {
+				t.Errorf("attempt %d: delay is %s, expected between %s and %s", test.attempt, delay, test.max/2, test.max)
+				break
+			}
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"throttled", &errs.ThrottledError{Err: &ec2.Error{Code: "Throttling"}}, true},
+		{"internal error", &ec2.Error{Code: "InternalError", StatusCode: 500}, true},
+		{"unavailable", &ec2.Error{Code: "Unavailable", StatusCode: 503}, true},
+		{"server error", &ec2.Error{Code: "Unknown", StatusCode: 502}, true},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"wrapped network error", fmt.Errorf("loading: %w", &net.DNSError{Err: "timeout", IsTimeout: true}), true},
+		{"client error", &ec2.Error{Code: "InvalidParameterValue", StatusCode: 400}, false},
+		{"not found", &errs.NotFoundError{Err: &ec2.Error{Code: "InvalidVolume.NotFound", StatusCode: 400}}, false},
+		{"config error", &errs.ConfigError{Message: "invalid"}, false},
+		{"other error", errors.New("other"), false},
+	}
+
+	for _, test := range tests {
+		retryable := Retryable(test.err)
+		if retryable != test.expected {
+			t.Errorf("%s: retryable is %t, expected %t", test.name, retryable, test.expected)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	baseDelay := BaseDelay
+	BaseDelay = time.Millisecond
+	SetLogger(ioutil.Discard, "", 0)
+	defer func() {
+		BaseDelay = baseDelay
+		SetLogger(os.Stderr, "", 0)
+	}()
+
+	tests := []struct {
+		name             string
+		do               func(string, func() error) error
+		err              error
+		expectedAttempts int
+	}{
+		{"success", Do, nil, 1},
+		{"transient", Do, &ec2.Error{Code: "InternalError", StatusCode: 500}, MaxAttempts},
+		{"permanent", Do, &ec2.Error{Code: "InvalidParameterValue", StatusCode: 400}, 1},
+		{"throttled", DoThrottled, &ec2.Error{Code: "RequestLimitExceeded", StatusCode: 503}, MaxAttempts},
+		{"server error not throttled", DoThrottled, &ec2.Error{Code: "InternalError", StatusCode: 500}, 1},
+	}
+
+	for _, test := range tests {
+		attempts := 0
+		err := test.do(test.name, func() error {
+			attempts++
+			return test.err
+		})
+
+		if attempts != test.expectedAttempts {
+			t.Errorf("%s: %d attempts, expected %d", test.name, attempts, test.expectedAttempts)
+		}
+
+		if (err == nil) != (test.err == nil) {
+			t.Errorf("%s: error is <%v>, expected <%v>", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package snapshot
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/NeowayLabs/cloud-machine/instance"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// Manifest describes which snapshot should be used to restore each volume
+	// of each node of a cluster
+	Manifest struct {
+		Default Default
+		Nodes   []Node
+	}
+
+	// Default overrides the values of all machines of the cluster, it's used
+	// to restore a cluster in another region
+	Default struct {
+		Region         string
+		AvailableZone  string
+		ImageID        string
+		KeyName        string
+		SecurityGroups []string
+		SubnetID       string
+	}
+
+	// Node has the snapshots of all volumes of one node of a cluster, the key
+	// of Volumes is the volume name as it is in the machine file and the value
+	// is the snapshot Id
+	Node struct {
+		Cluster string
+		Node    int
+		Volumes map[string]string
+	}
+)
+
+// LoadManifest read a manifest file
+func LoadManifest(file string) (Manifest, error) {
+	var manifest Manifest
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return manifest, err
+	}
+
+	err = yaml.Unmarshal(content, &manifest)
+	if err != nil {
+		return manifest, err
+	}
+
+	for _, node := range manifest.Nodes {
+		if node.Cluster == "" || node.Node < 1 {
+			return manifest, fmt.Errorf("Invalid manifest entry, cluster <%s> node <%d>", node.Cluster, node.Node)
+		}
+	}
+
+	return manifest, nil
+}
+
+// SaveManifest write the manifest to file
+func SaveManifest(file string, manifest Manifest) error {
+	content, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, content, 0644)
+}
+
+// SnapshotID returns the snapshot Id of a volume of a node, if the manifest
+// doesn't have this volume an empty string is returned
+func (manifest Manifest) SnapshotID(cluster string, node int, volume string) string {
+	for _, nodeConfig := range manifest.Nodes {
+		if nodeConfig.Cluster == cluster && nodeConfig.Node == node {
+			return nodeConfig.Volumes[volume]
+		}
+	}
+
+	return ""
+}
+
+// Apply overrides the instance values with the values of defaults that are
+// not empty
+func (defaults Default) Apply(instance *instance.Instance) {
+	if defaults.Region != "" {
+		instance.Region = defaults.Region
+	}
+	if defaults.AvailableZone != "" {
+		instance.AvailableZone = defaults.AvailableZone
+	}
+	if defaults.ImageID != "" {
+		instance.ImageID = defaults.ImageID
+	}
+	if defaults.KeyName != "" {
+		instance.KeyName = defaults.KeyName
+	}
+	if len(defaults.SecurityGroups) > 0 {
+		instance.SecurityGroups = defaults.SecurityGroups
+	}
+	if defaults.SubnetID != "" {
+		instance.SubnetID = defaults.SubnetID
+	}
+}
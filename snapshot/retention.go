@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/amz.v3/ec2"
+)
+
+// Retention describes which snapshots of a volume should be kept, a snapshot
+// is kept when it is one of the Last snapshots, or the newest snapshot of one
+// of the last Daily days, or the newest snapshot of one of the last Weekly
+// weeks. All other snapshots can be deleted.
+type Retention struct {
+	Last   int
+	Daily  int
+	Weekly int
+}
+
+// Empty returns true if the policy doesn't keep any snapshot
+func (retention Retention) Empty() bool {
+	return retention.Last <= 0 && retention.Daily <= 0 && retention.Weekly <= 0
+}
+
+// Expired returns the snapshots that are not kept by the retention policy,
+// all snapshots passed should be of the same volume. Snapshots that are not
+// completed yet are never expired.
+func (retention Retention) Expired(snapshots []ec2.Snapshot, now time.Time) ([]ec2.Snapshot, error) {
+	if retention.Empty() {
+		return nil, fmt.Errorf("The retention policy is empty, it would delete all snapshots")
+	}
+
+	sorted := make([]ec2.Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	Sort(sorted)
+
+	now = now.UTC()
+	dailyLimit := now.AddDate(0, 0, -retention.Daily)
+	weeklyLimit := now.AddDate(0, 0, -7*retention.Weekly)
+
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	expired := make([]ec2.Snapshot, 0)
+	completed := 0
+
+	for _, snapshot := range sorted {
+		if snapshot.Status != "completed" {
+			continue
+		}
+
+		startTime, err := StartTime(snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid start time of snapshot <%s>: %s", snapshot.Id, err.Error())
+		}
+
+		startTime = startTime.UTC()
+		keep := completed < retention.Last
+		completed++
+
+		day := startTime.Format("2006-01-02")
+		if retention.Daily > 0 && startTime.After(dailyLimit) && !days[day] {
+			days[day] = true
+			keep = true
+		}
+
+		year, weekNumber := startTime.ISOWeek()
+		week := fmt.Sprintf("%d-%d", year, weekNumber)
+		if retention.Weekly > 0 && startTime.After(weeklyLimit) && !weeks[week] {
+			weeks[week] = true
+			keep = true
+		}
+
+		if !keep {
+			expired = append(expired, snapshot)
+		}
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,71 @@
+package snapshot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/amz.v3/ec2"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	// a sunday, so the weeks of the snapshots are easy to see
+	now := time.Date(2017, 3, 12, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(id string, days int, status string) ec2.Snapshot {
+		return ec2.Snapshot{Id: id, Status: status, StartTime: now.AddDate(0, 0, -days).Format(time.RFC3339)}
+	}
+
+	snapshots := []ec2.Snapshot{
+		daysAgo("snap-8", 20, "completed"),
+		daysAgo("snap-1", 0, "completed"),
+		daysAgo("snap-2", 0, "completed"),
+		daysAgo("snap-3", 1, "completed"),
+		daysAgo("snap-4", 2, "completed"),
+		daysAgo("snap-5", 6, "completed"),
+		daysAgo("snap-6", 9, "completed"),
+		daysAgo("snap-7", 10, "pending"),
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		expected  []string
+	}{
+		{"last", Retention{Last: 2}, []string{"snap-3", "snap-4", "snap-5", "snap-6", "snap-8"}},
+		{"daily", Retention{Daily: 3}, []string{"snap-2", "snap-5", "snap-6", "snap-8"}},
+		{"weekly", Retention{Weekly: 2}, []string{"snap-2", "snap-3", "snap-4", "snap-5", "snap-8"}},
+		{"all", Retention{Last: 1, Daily: 2, Weekly: 3}, []string{"snap-2", "snap-4", "snap-5"}},
+		{"more than snapshots", Retention{Last: 10}, []string{}},
+	}
+
+	for _, test := range tests {
+		expired, err := test.retention.Expired(snapshots, now)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+
+		ids := make([]string, len(expired))
+		for key, snapshot := range expired {
+			ids[key] = snapshot.Id
+		}
+
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%s: expired %v, expected %v", test.name, ids, test.expected)
+		}
+	}
+}
+
+func TestRetentionExpiredEmpty(t *testing.T) {
+	_, err := Retention{}.Expired([]ec2.Snapshot{{Id: "snap-1", Status: "completed"}}, time.Now())
+	if err == nil {
+		t.Error("An empty retention should not expire snapshots")
+	}
+}
+
+func TestRetentionExpiredInvalidStartTime(t *testing.T) {
+	_, err := Retention{Last: 1}.Expired([]ec2.Snapshot{{Id: "snap-1", Status: "completed", StartTime: "yesterday"}}, time.Now())
+	if err == nil {
+		t.Error("A snapshot with invalid start time should be an error")
+	}
+}
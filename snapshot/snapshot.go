@@ -0,0 +1,212 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/NeowayLabs/cloud-machine/ec2ext"
+	"github.com/NeowayLabs/cloud-machine/retry"
+	"gopkg.in/amz.v3/ec2"
+)
+
+var loggerOutput io.Writer = os.Stderr
+var logger = log.New(loggerOutput, "", 0)
+
+// SetLogger ...
+func SetLogger(out io.Writer, prefix string, flag int) {
+	loggerOutput = out
+	logger = log.New(out, prefix, flag)
+}
+
+// Find returns all snapshots of the account that have all tags passed, public
+// and shared snapshots of other accounts can have the same tags
+func Find(ec2Ref *ec2ext.EC2, filterTags []ec2.Tag) ([]ec2.Snapshot, error) {
+	var snapshots []ec2.Snapshot
+	err := retry.Do("DescribeSnapshots", func() (err error) {
+		snapshots, err = ec2Ref.OwnSnapshots(nil, filterTags)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// VerifyOwned returns an error when one of the snapshots isn't of the account,
+// a manifest could have public or shared snapshots of other accounts
+func VerifyOwned(ec2Ref *ec2ext.EC2, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var snapshots []ec2.Snapshot
+	err := retry.Do("DescribeSnapshots", func() (err error) {
+		snapshots, err = ec2Ref.OwnSnapshots(ids, nil)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	owned := make(map[string]bool, len(snapshots))
+	for _, snapshot := range snapshots {
+		owned[snapshot.Id] = true
+	}
+
+	for _, id := range ids {
+		if !owned[id] {
+			return fmt.Errorf("The snapshot <%s> isn't of this account", id)
+		}
+	}
+
+	return nil
+}
+
+// Load a snapshot passing its Id
+func Load(ec2Ref *ec2ext.EC2, snapshot *ec2.Snapshot) error {
+	if snapshot.Id == "" {
+		return errors.New("To load a snapshot you need to pass its Id")
+	}
+
+	var resp *ec2.SnapshotsResp
+	err := retry.Do("DescribeSnapshots", func() (err error) {
+		resp, err = ec2Ref.Snapshots([]string{snapshot.Id}, nil)
+		return
+	})
+	if err != nil {
+		return err
+	} else if len(resp.Snapshots) == 0 {
+		return fmt.Errorf("Any snapshot was found with snapshot Id <%s>", snapshot.Id)
+	}
+
+	*snapshot = resp.Snapshots[0]
+
+	return nil
+}
+
+// WaitUntilState valid values to state is: pending, completed, error
+func WaitUntilState(ec2Ref *ec2ext.EC2, snapshot *ec2.Snapshot, state string) error {
+	fmt.Fprintf(loggerOutput, "Snapshot status is <%s>, waiting for <%s>", snapshot.Status, state)
+
+	for {
+		fmt.Fprint(loggerOutput, ".")
+		if snapshot.Status == "error" && state != "error" {
+			fmt.Fprintln(loggerOutput, " [ERROR]")
+			return fmt.Errorf("Snapshot <%s> failed", snapshot.Id)
+		} else if snapshot.Status != state {
+			time.Sleep(5 * time.Second)
+			err := Load(ec2Ref, snapshot)
+			if err != nil {
+				fmt.Fprintln(loggerOutput, " [ERROR]")
+				return err
+			}
+		} else {
+			fmt.Fprintln(loggerOutput, " [OK]")
+			return nil
+		}
+	}
+}
+
+// Create a snapshot of the volume with the tags passed and wait until it is
+// completed
+func Create(ec2Ref *ec2ext.EC2, volumeID string, description string, snapshotTags []ec2.Tag) (ec2.Snapshot, error) {
+	logger.Printf("Creating snapshot of volume <%s>...\n", volumeID)
+	var resp *ec2.CreateSnapshotResp
+	err := retry.DoThrottled("CreateSnapshot", func() (err error) {
+		resp, err = ec2Ref.CreateSnapshot(volumeID, description)
+		return
+	})
+	if err != nil {
+		return ec2.Snapshot{}, err
+	}
+
+	snapshot := resp.Snapshot
+	if len(snapshotTags) > 0 {
+		err = retry.Do("CreateTags", func() error {
+			_, err := ec2Ref.CreateTags([]string{snapshot.Id}, snapshotTags)
+			return err
+		})
+		if err != nil {
+			return ec2.Snapshot{}, err
+		}
+	}
+
+	err = WaitUntilState(ec2Ref, &snapshot, "completed")
+	if err != nil {
+		return ec2.Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// Copy a snapshot of sourceRegion to the region of ec2Ref, the tags of the
+// snapshot are copied too
+func Copy(ec2Ref *ec2ext.EC2, sourceRegion string, source ec2.Snapshot) (ec2.Snapshot, error) {
+	logger.Printf("Copying snapshot <%s> from <%s>...\n", source.Id, sourceRegion)
+	var resp *ec2ext.CopySnapshotResp
+	err := retry.DoThrottled("CopySnapshot", func() (err error) {
+		resp, err = ec2Ref.CopySnapshot(sourceRegion, source.Id, source.Description)
+		return
+	})
+	if err != nil {
+		return ec2.Snapshot{}, err
+	}
+
+	copied := ec2.Snapshot{Id: resp.SnapshotID}
+	if len(source.Tags) > 0 {
+		err = retry.Do("CreateTags", func() error {
+			_, err := ec2Ref.CreateTags([]string{copied.Id}, source.Tags)
+			return err
+		})
+		if err != nil {
+			return ec2.Snapshot{}, err
+		}
+	}
+
+	err = Load(ec2Ref, &copied)
+	if err != nil {
+		return ec2.Snapshot{}, err
+	}
+
+	err = WaitUntilState(ec2Ref, &copied, "completed")
+	if err != nil {
+		return ec2.Snapshot{}, err
+	}
+
+	return copied, nil
+}
+
+// Delete the snapshots passed
+func Delete(ec2Ref *ec2ext.EC2, snapshots []ec2.Snapshot) error {
+	for _, snapshot := range snapshots {
+		logger.Printf("Deleting snapshot <%s> of <%s>...\n", snapshot.Id, snapshot.StartTime)
+		err := retry.Do("DeleteSnapshots", func() error {
+			_, err := ec2Ref.DeleteSnapshots([]string{snapshot.Id})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartTime returns when the snapshot was taken
+func StartTime(snapshot ec2.Snapshot) (time.Time, error) {
+	return time.Parse(time.RFC3339, snapshot.StartTime)
+}
+
+// Sort the snapshots from the newest to the oldest
+func Sort(snapshots []ec2.Snapshot) {
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		// RFC3339 dates in UTC can be compared as strings
+		return snapshots[i].StartTime > snapshots[j].StartTime
+	})
+}
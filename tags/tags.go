@@ -0,0 +1,90 @@
+package tags
+
+import (
+	"strings"
+
+	"gopkg.in/amz.v3/ec2"
+)
+
+// Keys of the tags used by cloud-machine to find the resources it created
+const (
+	Cluster = "cloud-machine:cluster"
+	Node    = "cloud-machine:node"
+	Volume  = "cloud-machine:volume"
+	// Formatted is false on new volumes until they are formatted, volumes
+	// without it were created before it and are formatted
+	Formatted = "cloud-machine:formatted"
+	// RequestedType is the type of the machine file when the instance was
+	// created with one of its fallback types
+	RequestedType = "cloud-machine:requestedtype"
+)
+
+// Get returns the value of tag key, the key is case insensitive
+func Get(tags []ec2.Tag, key string) string {
+	for _, tag := range tags {
+		if strings.EqualFold(tag.Key, key) {
+			return tag.Value
+		}
+	}
+
+	return ""
+}
+
+// Set add or replace the tag key
+func Set(tags []ec2.Tag, key, value string) []ec2.Tag {
+	result := make([]ec2.Tag, 0, len(tags)+1)
+	for _, tag := range tags {
+		if !strings.EqualFold(tag.Key, key) {
+			result = append(result, tag)
+		}
+	}
+
+	return append(result, ec2.Tag{Key: key, Value: value})
+}
+
+// Remove returns the tags without the keys passed
+func Remove(tags []ec2.Tag, keys ...string) []ec2.Tag {
+	result := make([]ec2.Tag, 0, len(tags))
+	for _, tag := range tags {
+		remove := false
+		for _, key := range keys {
+			if strings.EqualFold(tag.Key, key) {
+				remove = true
+			}
+		}
+
+		if !remove {
+			result = append(result, tag)
+		}
+	}
+
+	return result
+}
+
+// Merge add to tags all defaults that aren't in tags yet
+func Merge(tags []ec2.Tag, defaults []ec2.Tag) []ec2.Tag {
+	for _, tag := range defaults {
+		addTag := true
+		for _, current := range tags {
+			if strings.EqualFold(current.Key, tag.Key) {
+				addTag = false
+			}
+		}
+
+		if addTag {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// Filter returns a ec2 filter that matches resources having all tags
+func Filter(tags []ec2.Tag) *ec2.Filter {
+	filter := ec2.NewFilter()
+	for _, tag := range tags {
+		filter.Add("tag:"+tag.Key, tag.Value)
+	}
+
+	return filter
+}
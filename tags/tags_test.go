@@ -0,0 +1,77 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/amz.v3/ec2"
+)
+
+func tag(key, value string) ec2.Tag {
+	return ec2.Tag{Key: key, Value: value}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []ec2.Tag
+		defaults []ec2.Tag
+		expected []ec2.Tag
+	}{
+		{"empty", nil, nil, nil},
+		{"only defaults", nil, []ec2.Tag{tag("env", "prod")}, []ec2.Tag{tag("env", "prod")}},
+		{"only tags", []ec2.Tag{tag("env", "prod")}, nil, []ec2.Tag{tag("env", "prod")}},
+		{"tags win", []ec2.Tag{tag("env", "dev")}, []ec2.Tag{tag("env", "prod")}, []ec2.Tag{tag("env", "dev")}},
+		{"case insensitive", []ec2.Tag{tag("Env", "dev")}, []ec2.Tag{tag("env", "prod")}, []ec2.Tag{tag("Env", "dev")}},
+		{"defaults appended", []ec2.Tag{tag("env", "dev")}, []ec2.Tag{tag("team", "data"), tag("env", "prod")}, []ec2.Tag{tag("env", "dev"), tag("team", "data")}},
+	}
+
+	for _, test := range tests {
+		merged := Merge(test.tags, test.defaults)
+		if !reflect.DeepEqual(merged, test.expected) {
+			t.Errorf("%s: merged %v, expected %v", test.name, merged, test.expected)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []ec2.Tag
+		key      string
+		value    string
+		expected []ec2.Tag
+	}{
+		{"new", nil, "env", "prod", []ec2.Tag{tag("env", "prod")}},
+		{"replace", []ec2.Tag{tag("env", "dev"), tag("team", "data")}, "env", "prod", []ec2.Tag{tag("team", "data"), tag("env", "prod")}},
+		{"case insensitive", []ec2.Tag{tag("Env", "dev")}, "env", "prod", []ec2.Tag{tag("env", "prod")}},
+	}
+
+	for _, test := range tests {
+		result := Set(test.tags, test.key, test.value)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: tags are %v, expected %v", test.name, result, test.expected)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []ec2.Tag
+		keys     []string
+		expected []ec2.Tag
+	}{
+		{"missing", []ec2.Tag{tag("env", "dev")}, []string{"team"}, []ec2.Tag{tag("env", "dev")}},
+		{"one", []ec2.Tag{tag("env", "dev"), tag("team", "data")}, []string{"env"}, []ec2.Tag{tag("team", "data")}},
+		{"many", []ec2.Tag{tag("env", "dev"), tag("team", "data"), tag("role", "db")}, []string{"env", "ROLE"}, []ec2.Tag{tag("team", "data")}},
+		{"all", []ec2.Tag{tag("env", "dev")}, []string{"env"}, []ec2.Tag{}},
+	}
+
+	for _, test := range tests {
+		result := Remove(test.tags, test.keys...)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: tags are %v, expected %v", test.name, result, test.expected)
+		}
+	}
+}
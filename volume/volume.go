@@ -6,8 +6,13 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/NeowayLabs/cloud-machine/ec2ext"
+	"github.com/NeowayLabs/cloud-machine/errs"
+	"github.com/NeowayLabs/cloud-machine/retry"
+	"github.com/NeowayLabs/cloud-machine/tags"
 	"gopkg.in/amz.v3/ec2"
 )
 
@@ -32,10 +37,19 @@ type Volume struct {
 	Device        string
 	Mount         string
 	FileSystem    string
+	OnDestroy     string
 	Tags          []ec2.Tag // ec2.Volume already have this property but yml would need new section
 	ec2.Volume
 }
 
+// Valid values to OnDestroy, what is done with the volume when its instance
+// is destroyed
+const (
+	OnDestroyKeep     = "keep"
+	OnDestroySnapshot = "snapshot"
+	OnDestroyDelete   = "delete"
+)
+
 func mergeVolumes(volume *Volume, ec2Volume *ec2.Volume) {
 	volume.Volume = *ec2Volume
 	// Volume struct has some fields that is present in ec2.Volume
@@ -59,7 +73,7 @@ func mergeVolumes(volume *Volume, ec2Volume *ec2.Volume) {
 
 // WaitUntilState valid values to state is: creating, available, in-use,
 // deleting, deleted, error
-func WaitUntilState(ec2Ref *ec2.EC2, volume *Volume, state string) error {
+func WaitUntilState(ec2Ref *ec2ext.EC2, volume *Volume, state string) error {
 	fmt.Fprintf(loggerOutput, "Volume status is <%s>, waiting for <%s>", volume.Status, state)
 
 	for {
@@ -78,8 +92,59 @@ func WaitUntilState(ec2Ref *ec2.EC2, volume *Volume, state string) error {
 	}
 }
 
+// AttachTimeout is how long WaitUntilAttached waits, an attachment stuck in
+// attaching usually needs the instance to be stopped
+var AttachTimeout = 5 * time.Minute
+
+// WaitUntilAttached waits until the attachment of the volume to the instance
+// is attached, if the volume is attached to another instance or device or it
+// isn't attached after AttachTimeout an error is returned
+func WaitUntilAttached(ec2Ref *ec2ext.EC2, volume *Volume, instanceID string, device string) error {
+	fmt.Fprintf(loggerOutput, "Waiting volume <%s> be attached to <%s> on <%s>", volume.ID, instanceID, device)
+
+	deadline := time.Now().Add(AttachTimeout)
+	for {
+		fmt.Fprint(loggerOutput, ".")
+		if time.Now().After(deadline) {
+			fmt.Fprintln(loggerOutput, " [ERROR]")
+			return fmt.Errorf("Volume <%s> isn't attached to <%s> on <%s> after %s", volume.ID, instanceID, device, AttachTimeout)
+		}
+
+		_, err := Load(ec2Ref, volume)
+		if err != nil {
+			fmt.Fprintln(loggerOutput, " [ERROR]")
+			return err
+		}
+
+		for _, attachment := range volume.Attachments {
+			if attachment.InstanceId != instanceID || !SameDevice(attachment.Device, device) {
+				fmt.Fprintln(loggerOutput, " [ERROR]")
+				return &errs.AlreadyAttachedError{VolumeID: volume.ID, InstanceID: attachment.InstanceId, Device: attachment.Device}
+			}
+
+			if attachment.Status == "attached" {
+				fmt.Fprintln(loggerOutput, " [OK]")
+				return nil
+			}
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// SameDevice compares devices ignoring the /dev/sdX and /dev/xvdX differences
+func SameDevice(device1, device2 string) bool {
+	normalize := func(device string) string {
+		device = strings.TrimPrefix(device, "/dev/")
+		device = strings.TrimPrefix(device, "xv")
+		return strings.TrimPrefix(device, "s")
+	}
+
+	return normalize(device1) == normalize(device2)
+}
+
 // Get a volume, if Id was not passed a new volume will be created
-func Get(ec2Ref *ec2.EC2, volume *Volume) (ec2Volume ec2.Volume, err error) {
+func Get(ec2Ref *ec2ext.EC2, volume *Volume) (ec2Volume ec2.Volume, err error) {
 	if volume.ID == "" {
 		logger.Printf("Creating new volume...\n")
 		ec2Volume, err = Create(ec2Ref, volume)
@@ -108,28 +173,35 @@ func Get(ec2Ref *ec2.EC2, volume *Volume) (ec2Volume ec2.Volume, err error) {
 	logger.Printf("    Device: %s\n", volume.Device)
 	logger.Printf("    Mount: %s\n", volume.Mount)
 	logger.Printf("    File System: %s\n", volume.FileSystem)
+	if volume.OnDestroy != "" {
+		logger.Printf("    On Destroy: %s\n", volume.OnDestroy)
+	}
 	if len(volume.Tags) > 0 {
 		logger.Printf("    Tags:\n")
 		for _, tag := range volume.Tags {
 			logger.Printf("        %s: %s\n", tag.Key, tag.Value)
 		}
 	}
-	logger.Println("----------------------------------\n")
+	logger.Printf("----------------------------------\n\n")
 
 	return
 }
 
 // Load a volume passing its Id
-func Load(ec2Ref *ec2.EC2, volume *Volume) (ec2.Volume, error) {
+func Load(ec2Ref *ec2ext.EC2, volume *Volume) (ec2.Volume, error) {
 	if volume.ID == "" {
 		return ec2.Volume{}, errors.New("To load a volume you need to pass its Id")
 	}
 
-	resp, err := ec2Ref.Volumes([]string{volume.ID}, nil)
+	var resp *ec2.VolumesResp
+	err := retry.Do("DescribeVolumes", func() (err error) {
+		resp, err = ec2Ref.Volumes([]string{volume.ID}, nil)
+		return
+	})
 	if err != nil {
 		return ec2.Volume{}, err
 	} else if len(resp.Volumes) == 0 {
-		return ec2.Volume{}, fmt.Errorf("Any volume was found with volume Id <%s>", volume.ID)
+		return ec2.Volume{}, &errs.NotFoundError{Resource: "volume", ID: volume.ID}
 	}
 
 	ec2Volume := resp.Volumes[0]
@@ -139,7 +211,7 @@ func Load(ec2Ref *ec2.EC2, volume *Volume) (ec2.Volume, error) {
 }
 
 // Create new volume
-func Create(ec2Ref *ec2.EC2, volume *Volume) (ec2.Volume, error) {
+func Create(ec2Ref *ec2ext.EC2, volume *Volume) (ec2.Volume, error) {
 	options := ec2.CreateVolume{
 		VolumeType: volume.Type,
 		AvailZone:  volume.AvailableZone,
@@ -157,14 +229,20 @@ func Create(ec2Ref *ec2.EC2, volume *Volume) (ec2.Volume, error) {
 		options.IOPS = volume.IOPS
 	}
 
-	resp, err := ec2Ref.CreateVolume(options)
+	var resp *ec2.CreateVolumeResp
+	err := retry.DoThrottled("CreateVolume", func() (err error) {
+		resp, err = ec2Ref.CreateVolume(options)
+		return
+	})
 	if err != nil {
 		return ec2.Volume{}, err
 	}
 
 	ec2Volume := resp.Volume
-	tags := append(volume.Tags, ec2.Tag{"Name", volume.Name})
-	_, err = ec2Ref.CreateTags([]string{ec2Volume.Id}, tags)
+	err = retry.Do("CreateTags", func() error {
+		_, err := ec2Ref.CreateTags([]string{ec2Volume.Id}, tags.Set(volume.Tags, "Name", volume.Name))
+		return err
+	})
 	if err != nil {
 		return ec2.Volume{}, err
 	}
@@ -178,3 +256,83 @@ func Create(ec2Ref *ec2.EC2, volume *Volume) (ec2.Volume, error) {
 
 	return ec2Volume, nil
 }
+
+// Find returns all volumes that have all tags passed and were not deleted
+func Find(ec2Ref *ec2ext.EC2, filterTags []ec2.Tag) ([]Volume, error) {
+	filter := tags.Filter(filterTags)
+	filter.Add("status", "creating", "available", "in-use")
+
+	return describe(ec2Ref, filter)
+}
+
+// Attached returns all volumes attached to the instance
+func Attached(ec2Ref *ec2ext.EC2, instanceID string) ([]Volume, error) {
+	filter := ec2.NewFilter()
+	filter.Add("attachment.instance-id", instanceID)
+
+	return describe(ec2Ref, filter)
+}
+
+func describe(ec2Ref *ec2ext.EC2, filter *ec2.Filter) ([]Volume, error) {
+	var resp *ec2.VolumesResp
+	err := retry.Do("DescribeVolumes", func() (err error) {
+		resp, err = ec2Ref.Volumes(nil, filter)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make([]Volume, len(resp.Volumes))
+	for key := range resp.Volumes {
+		mergeVolumes(&volumes[key], &resp.Volumes[key])
+	}
+
+	return volumes, nil
+}
+
+// Detach the volume of the instance that it is attached and wait until it is
+// available again
+func Detach(ec2Ref *ec2ext.EC2, volume *Volume) error {
+	for _, attachment := range volume.Attachments {
+		logger.Printf("Detaching volume <%s> from instance <%s>...\n", volume.ID, attachment.InstanceId)
+		attachment := attachment
+		err := retry.Do("DetachVolume", func() error {
+			_, err := ec2Ref.DetachVolume(volume.ID, attachment.InstanceId, attachment.Device, false)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return WaitUntilState(ec2Ref, volume, "available")
+}
+
+// SetTag adds or replaces the tag key of the volume
+func SetTag(ec2Ref *ec2ext.EC2, volume *Volume, key, value string) error {
+	err := retry.Do("CreateTags", func() error {
+		_, err := ec2Ref.CreateTags([]string{volume.ID}, []ec2.Tag{{Key: key, Value: value}})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	volume.Tags = tags.Set(volume.Tags, key, value)
+	return nil
+}
+
+// Delete the volume
+func Delete(ec2Ref *ec2ext.EC2, volume Volume) error {
+	logger.Println("Deleting volume", volume.ID)
+	err := retry.Do("DeleteVolume", func() error {
+		_, err := ec2Ref.DeleteVolume(volume.ID)
+		return err
+	})
+	if err == nil {
+		logger.Printf("Volume <%s> was deleted!\n", volume.ID)
+	}
+
+	return err
+}
@@ -0,0 +1,26 @@
+package volume
+
+import "testing"
+
+func TestSameDevice(t *testing.T) {
+	tests := []struct {
+		device1  string
+		device2  string
+		expected bool
+	}{
+		{"/dev/sdf", "/dev/sdf", true},
+		{"/dev/sdf", "/dev/xvdf", true},
+		{"/dev/xvdf", "xvdf", true},
+		{"sdf", "/dev/xvdf", true},
+		{"/dev/sdf", "/dev/sdg", false},
+		{"/dev/xvdf", "/dev/xvdg", false},
+		{"/dev/sdf", "/dev/sdf1", false},
+	}
+
+	for _, test := range tests {
+		same := SameDevice(test.device1, test.device2)
+		if same != test.expected {
+			t.Errorf("SameDevice(%s, %s) is %t, expected %t", test.device1, test.device2, same, test.expected)
+		}
+	}
+}